@@ -4,9 +4,10 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"geerpc"
 	"gorpc/codec"
 	"gorpc/server"
-	"log"
+	"io"
 	"net"
 	"sync"
 )
@@ -71,22 +72,18 @@ func NewClient(network string, address string, opt *server.Option) (*Client, err
 
 	f, ok := codec.NewCodecFuncMap[opt.CodecType]
 	if !ok {
-		err := fmt.Errorf("invalid codec type %s", opt.CodecType)
-		log.Println("rpc client codec error:", err)
-		return nil, err
+		return nil, fmt.Errorf("invalid codec type %s", opt.CodecType)
 	}
 
 	// 与服务端建立连接
 	conn, err := net.Dial(network, address)
 	if err != nil {
-		log.Println("Rpc client connect to server failed:", err)
 		return nil, err
 	}
 
 	// 发送option，告诉服务端使用什么编码器
 	if err := json.NewEncoder(conn).Encode(opt); err != nil {
 		// 如果发送错误，关闭连接
-		log.Println("Rpc client option json encode err:", err)
 		_ = conn.Close()
 		return nil, err
 	}
@@ -134,6 +131,13 @@ func (c *Client) removeCall(seq uint64) *Call {
 	return call
 }
 
+// log opt.Logger不为nil时输出一条日志
+func (c *Client) log(level geerpc.LogLevel, msg string, kv ...interface{}) {
+	if c.opt.Logger != nil {
+		c.opt.Logger.Log(level, msg, kv...)
+	}
+}
+
 // 服务端或客户端发生错误时调用
 // 取消所有请求，并关闭client
 func (c *Client) shutdown(err error) {
@@ -183,6 +187,9 @@ func (c *Client) receive() {
 	}
 
 	// @todo receive协程只有一个，这里出了问题退出之后怎么重启新的receive协程？
+	if err != io.EOF {
+		c.log(geerpc.LevelWarn, "rpc client: connection closed", geerpc.LogKeyError, err)
+	}
 	c.shutdown(err)
 }
 
@@ -207,6 +214,7 @@ func (c *Client) send(call *Call) {
 	// 这里发送完就退出，不等待结果
 	// 调用方需要通过监听call.Done通道去读取服务器返回的结果
 	if err := c.cc.Write(&c.header, call.Args); err != nil {
+		c.log(geerpc.LevelWarn, "rpc client: write request error", geerpc.LogKeyMethod, call.ServiceMethod, geerpc.LogKeySeq, seq, geerpc.LogKeyError, err)
 		call := c.removeCall(seq)
 		if call != nil {
 			call.Err = err
@@ -223,7 +231,7 @@ func (c *Client) Go(serviceMethod string, args, reply interface{}, done chan *Ca
 	} else if cap(done) == 0 {
 		// 非缓冲通道会阻塞写入：当通道中有数据时，需要等到该数据被取出后才能写入，效率不好
 		// 所以这里强制要求使用缓冲通道
-		log.Panic("rpc client: done channel is unbuffered")
+		panic("rpc client: done channel is unbuffered")
 	}
 	call := &Call{
 		ServiceMethod: serviceMethod,
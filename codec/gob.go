@@ -61,14 +61,13 @@ func (g *GobCodec) Write(h *Header, v interface{}) (err error) {
 		}
 	}()
 
+	// 错误交给调用方处理，编解码器本身不输出日志
 	if err := g.enc.Encode(h); err != nil {
-		fmt.Println("Rpc codec: gob encoding header err: ", err)
-		return err
+		return fmt.Errorf("rpc codec: gob encoding header: %w", err)
 	}
 
 	if err := g.enc.Encode(v); err != nil {
-		fmt.Println("Rpc codec: gob encoding body err: ", err)
-		return err
+		return fmt.Errorf("rpc codec: gob encoding body: %w", err)
 	}
 	return nil
 }
@@ -50,21 +50,22 @@ func (j *Json) ReadBody(i interface{}) error {
 // 将返回内容写入到conn
 func (j *Json) Write(header *Header, i interface{}) (err error) {
 	defer func() {
-		// 写完后一次性写入conn
-		err = j.buf.Flush()
+		// 写完后一次性写入conn，不能覆盖编码时的错误
+		if ferr := j.buf.Flush(); err == nil {
+			err = ferr
+		}
 		if err != nil {
 			_ = j.conn.Close()
 		}
 	}()
 
+	// 错误交给调用方处理，编解码器本身不输出日志
 	if err := j.enc.Encode(header); err != nil {
-		fmt.Println("Rpc codec: gob encoding header err: ", err)
-		return err
+		return fmt.Errorf("rpc codec: json encoding header: %w", err)
 	}
 
 	if err := j.enc.Encode(i); err != nil {
-		fmt.Println("Rpc codec: gob encoding header err: ", err)
-		return err
+		return fmt.Errorf("rpc codec: json encoding body: %w", err)
 	}
 	return nil
 }
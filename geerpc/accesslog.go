@@ -0,0 +1,80 @@
+package geerpc
+
+import (
+	"math/rand"
+	"time"
+)
+
+// AccessLogOption 访问日志的配置
+// 每次调用结束后输出一行日志，包括对方地址、ServiceMethod、Seq、编码类型、
+// 请求和响应的字节数、耗时和错误码
+type AccessLogOption struct {
+	Logger Logger // 输出访问日志，nil时使用ServerOption.Logger
+	// 记录的比例，取值0~1，nil表示全部记录。
+	// 0表示不记录成功的调用，配合SampleErrors为false可以只记录出错的调用
+	SampleRate   *float64
+	SampleErrors bool // 为true时出错的调用也按比例采样，默认出错的调用总是记录
+}
+
+// 访问日志中特有的key
+const (
+	LogKeyRequestSize  = "req_bytes"
+	LogKeyResponseSize = "resp_bytes"
+	LogKeyDuration     = "duration"
+	LogKeyCode         = "code"
+)
+
+type accessLogger struct {
+	logger       Logger
+	rate         float64
+	sampleErrors bool
+}
+
+func newAccessLogger(opt *AccessLogOption, fallback Logger) *accessLogger {
+	if opt == nil {
+		return nil
+	}
+	a := &accessLogger{logger: opt.Logger, rate: 1, sampleErrors: opt.SampleErrors}
+	if a.logger == nil {
+		a.logger = fallback
+	}
+	if opt.SampleRate != nil {
+		a.rate = *opt.SampleRate
+	}
+	return a
+}
+
+// sampled 这次调用是否需要记录
+func (a *accessLogger) sampled(err error) bool {
+	if err != nil && !a.sampleErrors {
+		return true
+	}
+	return a.rate >= 1 || rand.Float64() < a.rate
+}
+
+// wrap 返回在done之外还会记录访问日志的函数，调用和流共用
+// sizes在结束时调用，返回请求和响应的字节数，这时它们都已经确定
+func (a *accessLogger) wrap(sc *serverConn, serviceMethod string, seq uint64, sizes func() (int, int), done func(error)) func(error) {
+	start := time.Now()
+	return func(err error) {
+		done(err)
+		if !a.sampled(err) {
+			return
+		}
+		reqSize, respSize := sizes()
+		kv := []interface{}{
+			LogKeyRemote, sc.peer.remote(),
+			LogKeyMethod, serviceMethod,
+			LogKeySeq, seq,
+			LogKeyCodec, sc.opt.CodecType,
+			LogKeyRequestSize, reqSize,
+			LogKeyResponseSize, respSize,
+			LogKeyDuration, time.Since(start),
+			LogKeyCode, CodeOf(err),
+		}
+		if err != nil {
+			kv = append(kv, LogKeyError, err)
+		}
+		a.logger.Log(LevelInfo, "rpc server: access", kv...)
+	}
+}
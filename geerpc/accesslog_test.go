@@ -0,0 +1,163 @@
+package geerpc
+
+import (
+	"io"
+	"sync"
+	"testing"
+	"time"
+)
+
+// accessRecorder 按照key记录访问日志
+type accessRecorder struct {
+	mu      sync.Mutex
+	entries []map[string]interface{}
+}
+
+func (r *accessRecorder) Log(_ LogLevel, msg string, kv ...interface{}) {
+	if msg != "rpc server: access" {
+		return
+	}
+	entry := make(map[string]interface{})
+	for i := 0; i+1 < len(kv); i += 2 {
+		entry[kv[i].(string)] = kv[i+1]
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.entries = append(r.entries, entry)
+}
+
+// wait 等待记录了n条访问日志，服务端在发送响应之后才会记录
+func (r *accessRecorder) wait(t *testing.T, n int) []map[string]interface{} {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for {
+		r.mu.Lock()
+		entries := append([]map[string]interface{}(nil), r.entries...)
+		r.mu.Unlock()
+		if len(entries) >= n {
+			return entries
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expect %d access logs, got %d", n, len(entries))
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestAccessLog(t *testing.T) {
+	rec := new(accessRecorder)
+	addr := startServer(t, NewServer(&ServerOption{AccessLog: &AccessLogOption{Logger: rec}}), new(Calc))
+	client := dialTest(t, addr)
+
+	var reply int
+	if err := client.Call("Calc.Sum", CalcArgs{Num1: 1, Num2: 2}, &reply); err != nil {
+		t.Fatal(err)
+	}
+	e := rec.wait(t, 1)[0]
+	if e[LogKeyMethod] != "Calc.Sum" || e[LogKeySeq] != uint64(1) || e[LogKeyCode] != CodeOK {
+		t.Fatalf("unexpected access log %v", e)
+	}
+	if e[LogKeyRequestSize].(int) <= 0 || e[LogKeyResponseSize].(int) <= 0 {
+		t.Fatalf("expect request and response sizes, got %v", e)
+	}
+
+	// 流结束时记录一条访问日志，字节数包括流上所有的消息
+	cs, err := client.NewStream("Calc.Double")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		if err := cs.Send(i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := cs.CloseSend(); err != nil {
+		t.Fatal(err)
+	}
+	for cs.Recv(&reply) == nil {
+	}
+	e = rec.wait(t, 2)[1]
+	if e[LogKeyMethod] != "Calc.Double" || e[LogKeyCode] != CodeOK {
+		t.Fatalf("unexpected stream access log %v", e)
+	}
+	if e[LogKeyRequestSize].(int) < 10 || e[LogKeyResponseSize].(int) < 10 {
+		t.Fatalf("expect the sizes of all stream messages, got %v", e)
+	}
+
+	// 打开不存在的流
+	cs, err = client.NewStream("Calc.Missing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cs.Recv(&reply); CodeOf(err) != CodeNotFound {
+		t.Fatalf("err = %v, want CodeNotFound", err)
+	}
+	e = rec.wait(t, 3)[2]
+	if e[LogKeyMethod] != "Calc.Missing" || e[LogKeyCode] != CodeNotFound || e[LogKeyError] == nil {
+		t.Fatalf("unexpected access log %v", e)
+	}
+}
+
+func TestAccessLogSampling(t *testing.T) {
+	zero, half := 0.0, 0.5
+	for _, tt := range []struct {
+		sampleErrors bool
+		want         int
+	}{
+		{false, 6}, // SampleRate为0时只记录出错的调用
+		{true, 0},  // 出错的调用也按比例采样，什么都不记录
+	} {
+		rec := new(accessRecorder)
+		addr := startServer(t, NewServer(&ServerOption{AccessLog: &AccessLogOption{
+			Logger:       rec,
+			SampleRate:   &zero,
+			SampleErrors: tt.sampleErrors,
+		}}), new(Calc))
+		client := dialTest(t, addr)
+		var reply int
+		for i := 0; i < 5; i++ {
+			_ = client.Call("Calc.Sum", CalcArgs{}, &reply)
+			_ = client.Call("Calc.Missing", CalcArgs{}, &reply)
+		}
+		cs, err := client.NewStream("Calc.Double")
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = cs.CloseSend()
+		if err := cs.Recv(&reply); err != io.EOF {
+			t.Fatal(err)
+		}
+		// 最后一次调用的日志记录之后，之前的都已经记录了
+		_ = client.Call("Calc.Missing", CalcArgs{}, &reply)
+		if tt.want > 0 {
+			rec.wait(t, tt.want)
+		} else {
+			time.Sleep(50 * time.Millisecond)
+		}
+		rec.mu.Lock()
+		n := len(rec.entries)
+		for _, e := range rec.entries {
+			if e[LogKeyCode] == CodeOK {
+				t.Errorf("successful call should not be sampled: %v", e)
+			}
+		}
+		rec.mu.Unlock()
+		if n != tt.want {
+			t.Fatalf("SampleErrors=%v: got %d access logs, want %d", tt.sampleErrors, n, tt.want)
+		}
+	}
+
+	a := newAccessLogger(&AccessLogOption{SampleRate: &half}, nopLogger{})
+	sampled := 0
+	for i := 0; i < 1000; i++ {
+		if a.sampled(nil) {
+			sampled++
+		}
+	}
+	if sampled < 350 || sampled > 650 {
+		t.Fatalf("sampled %d of 1000 calls with SampleRate 0.5", sampled)
+	}
+	if a := newAccessLogger(&AccessLogOption{}, nopLogger{}); !a.sampled(nil) {
+		t.Fatal("nil SampleRate should record every call")
+	}
+}
@@ -0,0 +1,155 @@
+package geerpc
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"strconv"
+	"time"
+)
+
+// AuthInfo 认证通过后得到的调用方身份
+// 服务方法可以通过PeerFromContext获取
+type AuthInfo struct {
+	Identity string
+	Roles    []string
+}
+
+// hasRole 调用方是否拥有roles中的任意一个角色
+func (a *AuthInfo) hasRole(roles []string) bool {
+	if a == nil {
+		return false
+	}
+	for _, want := range roles {
+		for _, r := range a.Roles {
+			if r == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Authenticator 服务端在握手时认证客户端
+// ctx中可以通过PeerFromContext获取对方的地址和证书，opt.Auth是客户端发送的认证信息。
+// 返回错误时连接被拒绝，客户端会收到CodeUnauthenticated
+type Authenticator interface {
+	Authenticate(ctx context.Context, opt *Option) (*AuthInfo, error)
+}
+
+// AuthFunc 把普通函数转换成Authenticator
+type AuthFunc func(ctx context.Context, opt *Option) (*AuthInfo, error)
+
+func (f AuthFunc) Authenticate(ctx context.Context, opt *Option) (*AuthInfo, error) {
+	return f(ctx, opt)
+}
+
+// Credentials 客户端在握手时发送的认证信息，每次建立连接时调用
+// opt是即将发送给服务端的配置
+type Credentials interface {
+	Credentials(opt *Option) (map[string]string, error)
+}
+
+// TokenAuth 使用固定的token认证，key为token
+type TokenAuth map[string]*AuthInfo
+
+// Authenticate 和每一个token都做常数时间的比较，不能通过响应时间猜出token
+func (a TokenAuth) Authenticate(_ context.Context, opt *Option) (*AuthInfo, error) {
+	got := []byte(opt.Auth["token"])
+	var found *AuthInfo
+	var ok bool
+	for token, info := range a {
+		if subtle.ConstantTimeCompare(got, []byte(token)) == 1 && token != "" {
+			found, ok = info, true
+		}
+	}
+	if !ok {
+		return nil, Errorf(CodeUnauthenticated, "rpc server: invalid token")
+	}
+	return found, nil
+}
+
+// TokenCredentials 配合TokenAuth使用
+type TokenCredentials string
+
+func (c TokenCredentials) Credentials(_ *Option) (map[string]string, error) {
+	return map[string]string{"token": string(c)}, nil
+}
+
+// HMACAuth 客户端用共享密钥对身份、时间戳和编码类型签名
+// 时间戳和服务端的时间相差超过MaxSkew的签名无效，用来限制重放
+type HMACAuth struct {
+	Keys    map[string][]byte   // 每个身份的密钥
+	Roles   map[string][]string // 每个身份拥有的角色
+	MaxSkew time.Duration       // 默认5分钟
+}
+
+func (a *HMACAuth) Authenticate(_ context.Context, opt *Option) (*AuthInfo, error) {
+	identity := opt.Auth["identity"]
+	key, ok := a.Keys[identity]
+	if !ok || identity == "" {
+		return nil, Errorf(CodeUnauthenticated, "rpc server: unknown identity %q", identity)
+	}
+	ts, err := strconv.ParseInt(opt.Auth["timestamp"], 10, 64)
+	if err != nil {
+		return nil, Errorf(CodeUnauthenticated, "rpc server: invalid timestamp")
+	}
+	skew := a.MaxSkew
+	if skew <= 0 {
+		skew = 5 * time.Minute
+	}
+	if d := time.Since(time.Unix(ts, 0)); d > skew || d < -skew {
+		return nil, Errorf(CodeUnauthenticated, "rpc server: signature expired")
+	}
+	sig, err := hex.DecodeString(opt.Auth["signature"])
+	if err != nil || !hmac.Equal(sig, signOption(key, identity, opt.Auth["timestamp"], opt)) {
+		return nil, Errorf(CodeUnauthenticated, "rpc server: invalid signature")
+	}
+	return &AuthInfo{Identity: identity, Roles: a.Roles[identity]}, nil
+}
+
+// HMACCredentials 配合HMACAuth使用
+type HMACCredentials struct {
+	Identity string
+	Key      []byte
+}
+
+func (c *HMACCredentials) Credentials(opt *Option) (map[string]string, error) {
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	return map[string]string{
+		"identity":  c.Identity,
+		"timestamp": ts,
+		"signature": hex.EncodeToString(signOption(c.Key, c.Identity, ts, opt)),
+	}, nil
+}
+
+// signOption 计算签名，编码类型和魔数也参与签名，防止被篡改
+func signOption(key []byte, identity, timestamp string, opt *Option) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(identity + "\n" + timestamp + "\n" + string(opt.CodecType) + "\n" + strconv.Itoa(opt.MagicNumber)))
+	return mac.Sum(nil)
+}
+
+// TLSAuth 使用客户端证书中的身份认证，服务端必须校验客户端证书
+type TLSAuth struct {
+	Roles map[string][]string // 每个身份拥有的角色
+}
+
+func (a *TLSAuth) Authenticate(ctx context.Context, _ *Option) (*AuthInfo, error) {
+	p, ok := PeerFromContext(ctx)
+	if !ok || p.TLS == nil || len(p.TLS.VerifiedChains) == 0 {
+		return nil, Errorf(CodeUnauthenticated, "rpc server: client certificate required")
+	}
+	identity := p.Identity()
+	return &AuthInfo{Identity: identity, Roles: a.Roles[identity]}, nil
+}
+
+// authorize 检查调用方能否调用这个方法
+func authorize(p *Peer, mtype *methodType) error {
+	if len(mtype.roles) == 0 || p.Auth.hasRole(mtype.roles) {
+		return nil
+	}
+	return Errorf(CodePermissionDenied, "rpc server: permission denied")
+}
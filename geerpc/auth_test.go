@@ -0,0 +1,183 @@
+package geerpc
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/hex"
+	"io"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// credentialsFunc 测试时直接构造认证信息
+type credentialsFunc func(opt *Option) (map[string]string, error)
+
+func (f credentialsFunc) Credentials(opt *Option) (map[string]string, error) {
+	return f(opt)
+}
+
+// newAuthServer Auth.Whoami返回认证得到的身份，Auth.Admin只允许admin角色调用
+func newAuthServer(t *testing.T, auth Authenticator) *Server {
+	t.Helper()
+	server := NewServer(&ServerOption{Auth: auth})
+	whoami := func(ctx context.Context, _ int, reply *string) error {
+		p, _ := PeerFromContext(ctx)
+		*reply = p.Auth.Identity
+		return nil
+	}
+	if err := server.HandleFunc("Auth.Whoami", whoami); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.HandleFunc("Auth.Admin", whoami, &MethodOption{Roles: []string{"admin"}}); err != nil {
+		t.Fatal(err)
+	}
+	return server
+}
+
+// callAs 用opt建立连接并调用method
+func callAs(t *testing.T, addr, method string, opt *Option) (string, error) {
+	t.Helper()
+	client := dialTest(t, addr, opt)
+	var identity string
+	err := client.Call(method, 0, &identity)
+	return identity, err
+}
+
+func expectCode(t *testing.T, err error, code Code) {
+	t.Helper()
+	if CodeOf(err) != code {
+		t.Fatalf("err = %v, want code %v", err, code)
+	}
+}
+
+func TestTokenAuth(t *testing.T) {
+	addr := startServer(t, newAuthServer(t, TokenAuth{
+		"admin-token": {Identity: "alice", Roles: []string{"admin"}},
+		"user-token":  {Identity: "bob"},
+	}))
+
+	identity, err := callAs(t, addr, "Auth.Admin", &Option{Credentials: TokenCredentials("admin-token")})
+	if err != nil || identity != "alice" {
+		t.Fatalf("identity = %q, %v", identity, err)
+	}
+
+	// 没有角色的调用方被拒绝，但连接仍然可用
+	client := dialTest(t, addr, &Option{Credentials: TokenCredentials("user-token")})
+	err = client.Call("Auth.Admin", 0, &identity)
+	expectCode(t, err, CodePermissionDenied)
+	if err := client.Call("Auth.Whoami", 0, &identity); err != nil || identity != "bob" {
+		t.Fatalf("identity = %q, %v", identity, err)
+	}
+
+	for _, token := range []TokenCredentials{"bad-token", ""} {
+		_, err = callAs(t, addr, "Auth.Whoami", &Option{Credentials: token})
+		expectCode(t, err, CodeUnauthenticated)
+	}
+	_, err = callAs(t, addr, "Auth.Whoami", nil)
+	expectCode(t, err, CodeUnauthenticated)
+}
+
+func TestHMACAuth(t *testing.T) {
+	key := []byte("secret")
+	addr := startServer(t, newAuthServer(t, &HMACAuth{
+		Keys:    map[string][]byte{"alice": key, "bob": []byte("bob-secret")},
+		Roles:   map[string][]string{"alice": {"admin"}},
+		MaxSkew: time.Minute,
+	}))
+
+	identity, err := callAs(t, addr, "Auth.Admin", &Option{Credentials: &HMACCredentials{Identity: "alice", Key: key}})
+	if err != nil || identity != "alice" {
+		t.Fatalf("identity = %q, %v", identity, err)
+	}
+	_, err = callAs(t, addr, "Auth.Admin", &Option{Credentials: &HMACCredentials{Identity: "bob", Key: []byte("bob-secret")}})
+	expectCode(t, err, CodePermissionDenied)
+
+	// 密钥不对或者身份不存在
+	_, err = callAs(t, addr, "Auth.Whoami", &Option{Credentials: &HMACCredentials{Identity: "alice", Key: []byte("wrong")}})
+	expectCode(t, err, CodeUnauthenticated)
+	_, err = callAs(t, addr, "Auth.Whoami", &Option{Credentials: &HMACCredentials{Identity: "mallory", Key: key}})
+	expectCode(t, err, CodeUnauthenticated)
+
+	// 签名正确，但时间戳和服务端相差超过MaxSkew
+	signedAt := func(at time.Time) *Option {
+		return &Option{Credentials: credentialsFunc(func(opt *Option) (map[string]string, error) {
+			ts := strconv.FormatInt(at.Unix(), 10)
+			return map[string]string{
+				"identity":  "alice",
+				"timestamp": ts,
+				"signature": hex.EncodeToString(signOption(key, "alice", ts, opt)),
+			}, nil
+		})}
+	}
+	if _, err := callAs(t, addr, "Auth.Whoami", signedAt(time.Now().Add(-30*time.Second))); err != nil {
+		t.Fatalf("signature within MaxSkew: %v", err)
+	}
+	for _, at := range []time.Time{time.Now().Add(-2 * time.Minute), time.Now().Add(2 * time.Minute)} {
+		_, err = callAs(t, addr, "Auth.Whoami", signedAt(at))
+		expectCode(t, err, CodeUnauthenticated)
+	}
+}
+
+func TestTLSAuth(t *testing.T) {
+	ca := newTestCA(t)
+	server := newAuthServer(t, &TLSAuth{Roles: map[string][]string{"admin-1": {"admin"}}})
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = l.Close() })
+	go server.AcceptTLS(l, &tls.Config{
+		Certificates: []tls.Certificate{ca.issue(t, "server", true)},
+		ClientAuth:   tls.VerifyClientCertIfGiven,
+		ClientCAs:    ca.pool,
+	})
+	addr := l.Addr().String()
+	withCert := func(cn string) *Option {
+		config := &tls.Config{RootCAs: ca.pool}
+		if cn != "" {
+			config.Certificates = []tls.Certificate{ca.issue(t, cn, false)}
+		}
+		return &Option{TLSConfig: config}
+	}
+
+	identity, err := callAs(t, addr, "Auth.Admin", withCert("admin-1"))
+	if err != nil || identity != "admin-1" {
+		t.Fatalf("identity = %q, %v", identity, err)
+	}
+	_, err = callAs(t, addr, "Auth.Admin", withCert("user-1"))
+	expectCode(t, err, CodePermissionDenied)
+	identity, err = callAs(t, addr, "Auth.Whoami", withCert("user-1"))
+	if err != nil || identity != "user-1" {
+		t.Fatalf("identity = %q, %v", identity, err)
+	}
+	// 没有客户端证书
+	_, err = callAs(t, addr, "Auth.Whoami", withCert(""))
+	expectCode(t, err, CodeUnauthenticated)
+}
+
+// TestHandshakeTimeout 没有完成握手的连接在HandshakeTimeout后被关闭，握手完成后不再受它限制
+func TestHandshakeTimeout(t *testing.T) {
+	server := newAuthServer(t, TokenAuth{"token": {Identity: "alice"}})
+	server.opt.HandshakeTimeout = 50 * time.Millisecond
+	addr := startServer(t, server)
+
+	// 连接后什么都不发送
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = conn.Close() }()
+	_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, err := conn.Read(make([]byte, 1)); err != io.EOF {
+		t.Fatalf("read err = %v, want io.EOF after the handshake timeout", err)
+	}
+
+	client := dialTest(t, addr, &Option{Credentials: TokenCredentials("token")})
+	time.Sleep(100 * time.Millisecond)
+	var identity string
+	if err := client.Call("Auth.Whoami", 0, &identity); err != nil || identity != "alice" {
+		t.Fatalf("identity = %q, %v after the handshake", identity, err)
+	}
+}
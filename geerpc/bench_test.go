@@ -0,0 +1,45 @@
+package geerpc
+
+import (
+	"fmt"
+	"testing"
+)
+
+func benchClient(b *testing.B) *Client {
+	return dialTest(b, startServer(b, NewServer(), new(Calc)))
+}
+
+// BenchmarkCall 单个连接上的串行调用
+func BenchmarkCall(b *testing.B) {
+	client := benchClient(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var reply int
+		if err := client.Call("Calc.Sum", CalcArgs{Num1: i, Num2: 1}, &reply); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkCallParallel 很多协程共用一个连接并发调用
+// 每个协程的数量是GOMAXPROCS乘以parallelism
+func BenchmarkCallParallel(b *testing.B) {
+	for _, p := range []int{1, 8, 64} {
+		b.Run(fmt.Sprintf("parallelism=%d", p), func(b *testing.B) {
+			client := benchClient(b)
+			b.SetParallelism(p)
+			b.ReportAllocs()
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					var reply int
+					if err := client.Call("Calc.Sum", CalcArgs{Num1: 1, Num2: 2}, &reply); err != nil {
+						b.Error(err)
+						return
+					}
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,234 @@
+package geerpc
+
+import (
+	"sync"
+	"time"
+)
+
+// BreakerState 熔断器的状态
+type BreakerState int
+
+const (
+	BreakerClosed   BreakerState = iota // 正常放行
+	BreakerOpen                         // 熔断中，直接返回ErrCircuitOpen
+	BreakerHalfOpen                     // 冷却结束，放行少量试探请求
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// ErrCircuitOpen 后端地址处于熔断状态，调用没有发出
+// 错误码是CodeUnavailable，配置了重试策略时会换一个地址重试
+var ErrCircuitOpen error = &Error{Code: CodeUnavailable, Message: "rpc client: circuit breaker is open"}
+
+// BreakerOption 熔断器的配置，每个后端地址使用一个独立的熔断器
+// 连续失败次数或者统计窗口内的错误率任意一个达到阈值都会熔断
+type BreakerOption struct {
+	ConsecutiveFailures int           // 连续失败这么多次后熔断，默认5，小于0表示不按连续失败熔断
+	ErrorRate           float64       // 统计窗口内错误率达到它后熔断，取值0~1，0表示不按错误率熔断
+	MinRequests         int           // 统计窗口内至少有这么多请求才计算错误率，默认20
+	Window              time.Duration // 错误率的统计窗口，默认10s
+	CoolDown            time.Duration // 熔断后经过多久进入半开状态，默认5s
+	HalfOpenRequests    int           // 半开状态下同时放行的试探请求数，默认1
+
+	// 哪些错误码算作后端故障，默认CodeUnavailable、CodeDeadlineExceeded和CodeInternal
+	// 服务方法返回的业务错误不应该触发熔断
+	FailureCodes []Code
+
+	// 状态变化时调用，可以用来报警，不能阻塞
+	OnStateChange func(addr string, from, to BreakerState)
+}
+
+var defaultFailureCodes = []Code{CodeUnavailable, CodeDeadlineExceeded, CodeInternal}
+
+// breaker 一个后端地址的熔断器
+type breaker struct {
+	addr string
+	opt  *BreakerOption
+
+	mu          sync.Mutex // protect following
+	state       BreakerState
+	consecutive int       // 连续失败次数
+	windowStart time.Time // 当前统计窗口的开始时间
+	requests    int       // 当前统计窗口内的请求数
+	failures    int       // 当前统计窗口内的失败数
+	openedAt    time.Time
+	probes      int    // 半开状态下还没结束的试探请求数
+	generation  uint64 // 每次状态变化加一，旧状态下放行的请求结束时不再计入
+}
+
+func newBreaker(addr string, opt *BreakerOption) *breaker {
+	o := *opt
+	if o.ConsecutiveFailures == 0 {
+		o.ConsecutiveFailures = 5
+	}
+	if o.MinRequests <= 0 {
+		o.MinRequests = 20
+	}
+	if o.Window <= 0 {
+		o.Window = 10 * time.Second
+	}
+	if o.CoolDown <= 0 {
+		o.CoolDown = 5 * time.Second
+	}
+	if o.HalfOpenRequests <= 0 {
+		o.HalfOpenRequests = 1
+	}
+	if len(o.FailureCodes) == 0 {
+		o.FailureCodes = defaultFailureCodes
+	}
+	return &breaker{addr: addr, opt: &o, windowStart: time.Now()}
+}
+
+// ready 是否可能放行请求，不会占用试探请求的名额
+func (b *breaker) ready() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case BreakerOpen:
+		return time.Since(b.openedAt) >= b.opt.CoolDown
+	case BreakerHalfOpen:
+		return b.probes < b.opt.HalfOpenRequests
+	}
+	return true
+}
+
+// allow 判断是否放行一次请求，放行后必须用返回的generation调用done
+func (b *breaker) allow() (uint64, bool) {
+	b.mu.Lock()
+	var changed bool
+	var from BreakerState
+	defer func() {
+		b.mu.Unlock()
+		if changed {
+			b.notify(from, BreakerHalfOpen)
+		}
+	}()
+	if b.state == BreakerOpen {
+		if time.Since(b.openedAt) < b.opt.CoolDown {
+			return b.generation, false
+		}
+		from, changed = b.state, true
+		b.setState(BreakerHalfOpen)
+	}
+	if b.state == BreakerHalfOpen {
+		if b.probes >= b.opt.HalfOpenRequests {
+			return b.generation, false
+		}
+		b.probes++
+	}
+	return b.generation, true
+}
+
+// done 记录一次放行的请求的结果
+func (b *breaker) done(generation uint64, err error) {
+	failed := b.isFailure(err)
+	b.mu.Lock()
+	from := b.state
+	switch {
+	case generation != b.generation:
+		// 请求是在之前的状态下放行的
+	case CodeOf(err) == CodeCanceled:
+		// 调用方自己放弃的请求不能说明后端的状态
+		if b.state == BreakerHalfOpen {
+			b.probes--
+		}
+	case b.state == BreakerHalfOpen:
+		b.probes--
+		if failed {
+			b.trip()
+		} else {
+			b.reset()
+		}
+	case b.state == BreakerClosed:
+		now := time.Now()
+		if now.Sub(b.windowStart) >= b.opt.Window {
+			b.windowStart, b.requests, b.failures = now, 0, 0
+		}
+		b.requests++
+		if failed {
+			b.failures++
+			b.consecutive++
+		} else {
+			b.consecutive = 0
+		}
+		if b.shouldTrip() {
+			b.trip()
+		}
+	}
+	to := b.state
+	b.mu.Unlock()
+	if from != to {
+		b.notify(from, to)
+	}
+}
+
+// ignore 放行的请求因为和后端是否健康无关的原因失败，例如服务端正在关闭这个连接，不计入统计
+func (b *breaker) ignore(generation uint64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if generation == b.generation && b.state == BreakerHalfOpen {
+		b.probes--
+	}
+}
+
+func (b *breaker) shouldTrip() bool {
+	if b.opt.ConsecutiveFailures > 0 && b.consecutive >= b.opt.ConsecutiveFailures {
+		return true
+	}
+	return b.opt.ErrorRate > 0 && b.requests >= b.opt.MinRequests &&
+		float64(b.failures)/float64(b.requests) >= b.opt.ErrorRate
+}
+
+// trip 进入熔断状态
+func (b *breaker) trip() {
+	b.setState(BreakerOpen)
+	b.openedAt = time.Now()
+}
+
+// reset 恢复正常
+func (b *breaker) reset() {
+	b.setState(BreakerClosed)
+	b.consecutive = 0
+	b.windowStart, b.requests, b.failures = time.Now(), 0, 0
+}
+
+func (b *breaker) setState(state BreakerState) {
+	b.state = state
+	b.probes = 0
+	b.generation++
+}
+
+func (b *breaker) isFailure(err error) bool {
+	if err == nil {
+		return false
+	}
+	code := CodeOf(err)
+	for _, c := range b.opt.FailureCodes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+func (b *breaker) notify(from, to BreakerState) {
+	if b.opt.OnStateChange != nil {
+		b.opt.OnStateChange(b.addr, from, to)
+	}
+}
+
+func (b *breaker) current() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
@@ -0,0 +1,158 @@
+package geerpc
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type breakerEvents struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (e *breakerEvents) record(addr string, from, to BreakerState) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.events = append(e.events, fmt.Sprintf("%s->%s", from, to))
+}
+
+func (e *breakerEvents) get() []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]string(nil), e.events...)
+}
+
+// pass 放行一次请求并以err结束
+func pass(t *testing.T, b *breaker, err error) {
+	t.Helper()
+	g, ok := b.allow()
+	if !ok {
+		t.Fatalf("request rejected in state %s", b.current())
+	}
+	b.done(g, err)
+}
+
+func TestBreakerTransitions(t *testing.T) {
+	events := &breakerEvents{}
+	b := newBreaker("addr", &BreakerOption{
+		ConsecutiveFailures: 3,
+		CoolDown:            20 * time.Millisecond,
+		OnStateChange:       events.record,
+	})
+	unavailable := Errorf(CodeUnavailable, "down")
+
+	// 业务错误和成功都会打断连续失败
+	pass(t, b, unavailable)
+	pass(t, b, unavailable)
+	pass(t, b, errors.New("business error"))
+	pass(t, b, unavailable)
+	pass(t, b, unavailable)
+	if b.current() != BreakerClosed {
+		t.Fatalf("state = %s, want closed", b.current())
+	}
+	pass(t, b, unavailable)
+	if b.current() != BreakerOpen {
+		t.Fatalf("state = %s, want open", b.current())
+	}
+	if _, ok := b.allow(); ok || b.ready() {
+		t.Fatal("open breaker allowed a request")
+	}
+
+	// 冷却之后进入半开状态，只放行一个试探请求，失败后重新熔断
+	time.Sleep(30 * time.Millisecond)
+	if !b.ready() {
+		t.Fatal("breaker not ready after cool down")
+	}
+	g, ok := b.allow()
+	if !ok || b.current() != BreakerHalfOpen {
+		t.Fatalf("allow = %v, state = %s, want half-open probe", ok, b.current())
+	}
+	if _, ok := b.allow(); ok {
+		t.Fatal("half-open breaker allowed a second probe")
+	}
+	b.done(g, unavailable)
+	if b.current() != BreakerOpen {
+		t.Fatalf("state after failed probe = %s, want open", b.current())
+	}
+
+	// 试探成功后恢复正常
+	time.Sleep(30 * time.Millisecond)
+	pass(t, b, nil)
+	if b.current() != BreakerClosed {
+		t.Fatalf("state after successful probe = %s, want closed", b.current())
+	}
+
+	want := []string{"closed->open", "open->half-open", "half-open->open", "open->half-open", "half-open->closed"}
+	if got := events.get(); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("transitions = %v, want %v", got, want)
+	}
+}
+
+func TestBreakerErrorRate(t *testing.T) {
+	b := newBreaker("addr", &BreakerOption{ConsecutiveFailures: -1, ErrorRate: 0.5, MinRequests: 10})
+	unavailable := Errorf(CodeUnavailable, "down")
+	for i := 0; i < 9; i++ {
+		var err error
+		if i%2 == 0 {
+			err = unavailable
+		}
+		pass(t, b, err)
+	}
+	// 请求数不够时不计算错误率
+	if b.current() != BreakerClosed {
+		t.Fatalf("state = %s before MinRequests", b.current())
+	}
+	pass(t, b, unavailable)
+	if b.current() != BreakerOpen {
+		t.Fatalf("state = %s, want open at 60%% errors", b.current())
+	}
+}
+
+func TestBreakerStaleGeneration(t *testing.T) {
+	b := newBreaker("addr", &BreakerOption{ConsecutiveFailures: 1, CoolDown: 10 * time.Millisecond})
+	old, _ := b.allow()
+	pass(t, b, Errorf(CodeUnavailable, "down"))
+	time.Sleep(20 * time.Millisecond)
+	g, _ := b.allow()
+	// 熔断之前放行的请求结束，不影响半开状态的试探
+	b.done(old, nil)
+	if b.current() != BreakerHalfOpen {
+		t.Fatalf("stale result changed state to %s", b.current())
+	}
+	b.done(g, nil)
+	if b.current() != BreakerClosed {
+		t.Fatalf("state = %s, want closed", b.current())
+	}
+}
+
+func TestPoolBreaker(t *testing.T) {
+	addr, calls := flakyServer(t)
+	p, err := NewPool("tcp", []string{addr}, &PoolOption{
+		Size:         1,
+		PingInterval: -1,
+		Breaker:      &BreakerOption{ConsecutiveFailures: 2, CoolDown: time.Hour},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	var reply int
+	for i := 0; i < 2; i++ {
+		if err := p.Call("Flaky.Once", 1, &reply); CodeOf(err) != CodeUnavailable || err == ErrCircuitOpen {
+			t.Fatalf("call %d err = %v", i, err)
+		}
+	}
+	if p.BreakerState(addr) != BreakerOpen {
+		t.Fatalf("breaker state = %s, want open", p.BreakerState(addr))
+	}
+	if err := p.Call("Flaky.Once", 1, &reply); err != ErrCircuitOpen {
+		t.Fatalf("err = %v, want ErrCircuitOpen", err)
+	}
+	if n := atomic.LoadInt32(calls["Once"]); n != 2 {
+		t.Fatalf("server called %d times, want 2", n)
+	}
+}
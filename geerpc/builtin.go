@@ -0,0 +1,14 @@
+package geerpc
+
+// PingMethod 服务端内置的健康检查方法，所有Server都会注册
+// 参数是任意数字，服务端原样返回
+const PingMethod = "_rpc.Ping"
+
+// rpcBuiltin 服务端内置的服务，注册名为"_rpc"
+type rpcBuiltin struct{}
+
+// Ping 原样返回客户端发送的数字，用于检测连接是否可用
+func (b *rpcBuiltin) Ping(n uint64, reply *uint64) error {
+	*reply = n
+	return nil
+}
@@ -1,14 +1,17 @@
 package geerpc
 
 import (
+	"context"
+	"crypto/tls"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"geerpc/codec"
 	"io"
-	"log"
 	"net"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // Call represents an active RPC.
@@ -20,14 +23,53 @@ type Call struct {
 	Reply         interface{} // reply from the function
 	Error         error       // if error occurs, it will be set
 	Done          chan *Call  // Strobes when call is complete.
+
+	// 请求已经开始写入连接，服务端可能已经执行了这次调用
+	sent bool
+	// 调用结束时记录指标，可能为nil
+	observe func(err error)
+	// 链路追踪的span和随请求发送的元数据，没有配置Tracer时为nil
+	span Span
+	meta map[string]string
+}
+
+// callPool 同步调用拿到结果后就不再需要Call，复用它和Done通道
+// Go返回的Call交给了调用方，不会放回池中
+var callPool = sync.Pool{
+	New: func() interface{} {
+		return &Call{Done: make(chan *Call, 1)}
+	},
+}
+
+// free 清空call并放回池中
+// 调用方必须确认done不会再被调用，Done中残留的结果会被丢弃，下次使用时不会读到旧的call
+func (call *Call) free() {
+	done := call.Done
+	select {
+	case <-done:
+	default:
+	}
+	*call = Call{Done: done}
+	callPool.Put(call)
 }
 
 // 异步调用结束时，调用此方法通知调用方
 func (call *Call) done() {
+	call.finish(call.Error)
 	// 调用方会监听Done这个通道，这样有结果时就能收到响应的call实例
 	call.Done <- call
 }
 
+// finish 记录调用的结果，每次调用只会执行一次
+func (call *Call) finish(err error) {
+	if call.observe != nil {
+		call.observe(err)
+	}
+	if call.span != nil {
+		endSpan(call.span, call.Seq, err)
+	}
+}
+
 // Client represents an RPC Client.
 // There may be multiple outstanding Calls associated
 // with a single Client, and a Client may be used by
@@ -35,21 +77,36 @@ func (call *Call) done() {
 type Client struct {
 	cc  codec.Codec
 	opt *Option
+	// 连接上唯一的写协程，保证每一帧报文完整发出，不会混在一起
+	w *connWriter
 
-	// 保证请求有序发出，防止多个请求的报文混在一起
-	sending sync.Mutex // protect following
-	header  codec.Header
-	mu      sync.Mutex // protect following
+	mu sync.Mutex // protect following
 
 	// 用于给发送的请求编号，每个请求拥有唯一编号
 	seq uint64
 
 	// 未处理完的请求
 	pending map[uint64]*Call
+	// 还没结束的流，和pending共用seq编号
+	streams map[uint64]*ClientStream
+	// 服务端标记为幂等的方法，从响应头中得知
+	idempotent map[string]bool
 
 	// client的状态
 	closing  bool // user has called Close
 	shutdown bool // server has told us to stop
+	draining bool // server is going away, no new calls
+
+	// 连接不可用后关闭，用于通知关心连接状态的调用方
+	dead chan struct{}
+	// 收到服务端的FrameGoAway后关闭，调用方可以提前建立新的连接
+	goingAway chan struct{}
+	// 服务端的地址，用于指标
+	target string
+	// 连接被主动关闭的原因，非nil时还在等待的调用都以它结束
+	failed error
+	// 最近一次收到报文的时间，通过atomic访问
+	lastRecv int64
 }
 
 // 保证Client必须实现io.Closer接口
@@ -58,6 +115,10 @@ var _ io.Closer = (*Client)(nil)
 // 自定义一个错误，相当于一个错误类型，用于判断
 var ErrShutdown = errors.New("connection is shut down")
 
+// ErrGoingAway 服务端即将关闭，这个连接不再接受新的调用
+// 调用没有发出，可以放心地在其他连接上重试
+var ErrGoingAway error = &Error{Code: CodeUnavailable, Message: "rpc client: connection is going away"}
+
 // Close the connection
 func (client *Client) Close() error {
 	client.mu.Lock()
@@ -76,7 +137,22 @@ func (client *Client) IsAvailable() bool {
 	defer client.mu.Unlock()
 	// closing说明用户主动关闭了client
 	// shutdown说明发生了异常
-	return !client.shutdown && !client.closing
+	// draining说明服务端即将关闭
+	return !client.shutdown && !client.closing && !client.draining
+}
+
+// isDraining 服务端是否已经通知这个连接即将关闭
+func (client *Client) isDraining() bool {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	return client.draining
+}
+
+// numPending 返回还没收到响应的调用数，用来衡量连接的负载
+func (client *Client) numPending() int {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	return len(client.pending) + len(client.streams)
 }
 
 func (client *Client) registerCall(call *Call) (uint64, error) {
@@ -86,6 +162,9 @@ func (client *Client) registerCall(call *Call) (uint64, error) {
 		// 如果客户端正在关闭或已经关闭，不能再用此客户端实例发出rpc请求
 		return 0, ErrShutdown
 	}
+	if client.draining {
+		return 0, ErrGoingAway
+	}
 
 	call.Seq = client.seq
 	client.pending[call.Seq] = call
@@ -107,29 +186,53 @@ func (client *Client) removeCall(seq uint64) *Call {
 }
 
 func (client *Client) terminateCalls(err error) {
-	client.sending.Lock()
-	defer client.sending.Unlock()
+	client.w.close()
 	client.mu.Lock()
-	defer client.mu.Unlock()
 	client.shutdown = true
-	for _, call := range client.pending {
+	if client.failed != nil {
+		err = client.failed
+	}
+	// 先从pending中移除，写入失败的send和超时的调用就拿不到这些call，每个call只会结束一次
+	pending, streams := client.pending, client.streams
+	client.pending = make(map[uint64]*Call)
+	client.streams = make(map[uint64]*ClientStream)
+	client.mu.Unlock()
+
+	for _, call := range pending {
 		call.Error = err
 		call.done()
 	}
+	for _, cs := range streams {
+		cs.st.fail(err)
+		cs.end(err)
+	}
+	close(client.dead)
 }
 
 // 接受rpc服务端返回的响应
 func (client *Client) receive() {
 	var err error
+	// 每一帧都复用同一个header
+	var h codec.Header
 	for err == nil {
-		var h codec.Header
+		h = codec.Header{}
 		if err = client.cc.ReadHeader(&h); err != nil {
 			break
 		}
+		atomic.StoreInt64(&client.lastRecv, time.Now().UnixNano())
+		if h.Frame != codec.FrameCall {
+			// 流相关的报文
+			err = client.receiveFrame(&h)
+			client.closeIfDrained()
+			continue
+		}
 
 		// 能读取到header，说明本地调用已经完成，从client中移除call实例
 		// @todo 这里可能是nil
 		call := client.removeCall(h.Seq)
+		if h.Idempotent && call != nil {
+			client.markIdempotent(call.ServiceMethod)
+		}
 		switch {
 		case call == nil:
 			// it usually means that Write partially failed
@@ -139,18 +242,23 @@ func (client *Client) receive() {
 			err = client.cc.ReadBody(nil)
 		case h.Error != "":
 			// header中的Error非空，表示服务端发生了错误
-			call.Error = fmt.Errorf(h.Error)
+			call.Error = errorFromHeader(&h)
 			// 直接丢弃body部分
 			err = client.cc.ReadBody(nil)
 			call.done()
 		default:
 			// 将body读取到call实例
 			err = client.cc.ReadBody(call.Reply)
-			if err != nil {
+			if errors.Is(err, codec.ErrTooLarge) {
+				// 超过Option.Limits的body已经被编解码器丢弃，只有这个调用失败，连接可以继续使用
+				call.Error = Errorf(CodeResourceExhausted, "rpc client: reading body %v", err)
+				err = nil
+			} else if err != nil {
 				call.Error = errors.New("reading body " + err.Error())
 			}
 			call.done()
 		}
+		client.closeIfDrained()
 	}
 	// error occurs, so terminateCalls pending calls
 	// @todo 关闭全部请求？
@@ -162,24 +270,56 @@ func NewClient(conn net.Conn, opt *Option) (*Client, error) {
 	f := codec.NewCodecFuncMap[opt.CodecType]
 	if f == nil {
 		err := fmt.Errorf("invalid codec type %s", opt.CodecType)
-		log.Println("rpc client: codec error:", err)
+		orNop(opt.Logger).Log(LevelError, "rpc client: codec error", LogKeyCodec, opt.CodecType, LogKeyError, err)
 		return nil, err
 	}
+	if opt.Credentials != nil {
+		// 认证信息每个连接都不一样，不能修改调用方传入的opt
+		o := *opt
+		auth, err := o.Credentials.Credentials(&o)
+		if err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+		o.Auth = auth
+		opt = &o
+	}
 	// 发送option给服务端，告诉服务器使用什么编码器
 	if err := json.NewEncoder(conn).Encode(opt); err != nil {
-		log.Println("rpc client: options error: ", err)
+		orNop(opt.Logger).Log(LevelError, "rpc client: options error",
+			LogKeyRemote, conn.RemoteAddr().String(), LogKeyError, err)
 		_ = conn.Close()
 		return nil, err
 	}
-	return newClientCodec(f(conn), opt), nil
+	target := conn.RemoteAddr().String()
+	var rwc io.ReadWriteCloser = conn
+	if m := opt.Metrics; m != nil {
+		rwc = &countingConn{ReadWriteCloser: conn, report: func(in, out int) {
+			m.ClientBytes(target, opt.CodecType, in, out)
+		}}
+	}
+	cc := f(rwc)
+	setLimits(cc, limitsOf(opt.Limits))
+	client := newClientCodec(cc, opt)
+	client.target = target
+	if opt.KeepAlive != nil {
+		go client.keepalive(*opt.KeepAlive)
+	}
+	return client, nil
 }
 
 func newClientCodec(cc codec.Codec, opt *Option) *Client {
 	client := &Client{
-		seq:     1, // seq starts with 1, 0 means invalid call
-		cc:      cc,
-		opt:     opt,
-		pending: make(map[uint64]*Call),
+		seq:        1, // seq starts with 1, 0 means invalid call
+		cc:         cc,
+		opt:        opt,
+		w:          newConnWriter(cc),
+		pending:    make(map[uint64]*Call),
+		streams:    make(map[uint64]*ClientStream),
+		idempotent: make(map[string]bool),
+		dead:       make(chan struct{}),
+		goingAway:  make(chan struct{}),
+		lastRecv:   time.Now().UnixNano(),
 	}
 	// 通过协程等待读取服务端响应的信息
 	// @todo 如果出了问题？怎么知道client还能不能用？
@@ -195,21 +335,34 @@ func parseOptions(opts ...*Option) (*Option, error) {
 	if len(opts) != 1 {
 		return nil, errors.New("number of options is more than 1")
 	}
-	opt := opts[0]
+	// 复制一份，同一个Option可能同时被多个Dial使用
+	opt := *opts[0]
 	opt.MagicNumber = DefaultOption.MagicNumber
 	if opt.CodecType == "" {
 		opt.CodecType = DefaultOption.CodecType
 	}
-	return opt, nil
+	return &opt, nil
 }
 
+type newClientFunc func(conn net.Conn, opt *Option) (client *Client, err error)
+
 // Dial connects to an RPC server at the specified network address
 func Dial(network, address string, opts ...*Option) (client *Client, err error) {
+	return dial(NewClient, network, address, opts...)
+}
+
+// dial 建立连接，然后由f完成握手
+func dial(f newClientFunc, network, address string, opts ...*Option) (client *Client, err error) {
 	opt, err := parseOptions(opts...)
 	if err != nil {
 		return nil, err
 	}
-	conn, err := net.Dial(network, address)
+	var conn net.Conn
+	if opt.TLSConfig != nil {
+		conn, err = tls.Dial(network, address, opt.TLSConfig)
+	} else {
+		conn, err = net.Dial(network, address)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -219,15 +372,11 @@ func Dial(network, address string, opts ...*Option) (client *Client, err error)
 			_ = conn.Close()
 		}
 	}()
-	return NewClient(conn, opt)
+	return f(conn, opt)
 }
 
 // 发送rpc请求
 func (client *Client) send(call *Call) {
-	// make sure that the client will send a complete request
-	client.sending.Lock()
-	defer client.sending.Unlock()
-
 	// register this call.
 	seq, err := client.registerCall(call)
 	if err != nil {
@@ -237,14 +386,13 @@ func (client *Client) send(call *Call) {
 	}
 
 	// prepare request header
-	client.header.ServiceMethod = call.ServiceMethod
-	client.header.Seq = seq
-	client.header.Error = ""
+	h := codec.Header{ServiceMethod: call.ServiceMethod, Seq: seq, Meta: call.meta}
 
 	// encode and send the request
 	// 发送请求后直接返回，不等待结果
 	// receive协程会等待结果并将结果写入call实例
-	if err := client.cc.Write(&client.header, call.Args); err != nil {
+	call.sent = true
+	if _, err := client.w.write(&h, call.Args); err != nil {
 		call := client.removeCall(seq)
 		// call may be nil, it usually means that Write partially failed,
 		// client has received the response and handled
@@ -258,13 +406,18 @@ func (client *Client) send(call *Call) {
 // Go invokes the function asynchronously.
 // It returns the Call structure representing the invocation.
 func (client *Client) Go(serviceMethod string, args, reply interface{}, done chan *Call) *Call {
+	return client.goContext(context.Background(), serviceMethod, args, reply, done)
+}
+
+// goContext 和Go一样，ctx中的追踪信息会随请求发送给服务端
+func (client *Client) goContext(ctx context.Context, serviceMethod string, args, reply interface{}, done chan *Call) *Call {
 	if done == nil {
 		// @todo 这里为什么是10
 		done = make(chan *Call, 10)
 	} else if cap(done) == 0 {
 		// 如果容量为0，则是非缓冲通道，这样会出现阻塞现象：写入一个值后，要等到这个值被取出才能写入下一个值
 		// 所以为了提高效率，这里要求chan必须为缓冲通道
-		log.Panic("rpc client: done channel is unbuffered")
+		panic("rpc client: done channel is unbuffered")
 	}
 	call := &Call{
 		ServiceMethod: serviceMethod,
@@ -273,14 +426,211 @@ func (client *Client) Go(serviceMethod string, args, reply interface{}, done cha
 		Done:          done,
 	}
 	// 这里发出请求后就直接返回，异步等待结果
-	client.send(call)
+	client.start(ctx, call)
 	return call
 }
 
+// start 开始记录指标和链路追踪，然后发送请求
+func (client *Client) start(ctx context.Context, call *Call) {
+	call.observe = observeClient(client.opt.Metrics, client.target, call.ServiceMethod)
+	if t := client.opt.Tracer; t != nil {
+		ctx, call.span = startSpan(ctx, t, call.ServiceMethod, SpanKindClient, string(client.opt.CodecType))
+		call.span.SetAttribute(AttrPeerAddress, client.target)
+		call.meta = make(map[string]string)
+		t.Inject(ctx, call.meta)
+	}
+	client.send(call)
+}
+
 // Call invokes the named function, waits for it to complete,
 // and returns its error status.
 func (client *Client) Call(serviceMethod string, args, reply interface{}) error {
-	// 这里会堵塞，直到请求返回结果后才能接收到call实例
-	call := <-client.Go(serviceMethod, args, reply, make(chan *Call, 1)).Done
-	return call.Error
-}
\ No newline at end of file
+	return client.CallContext(context.Background(), serviceMethod, args, reply)
+}
+
+// CallContext 和Call一样，但是可以通过ctx取消等待
+// ctx结束时本次调用从pending中移除，之后收到的响应会被丢弃
+// 配置了Option.Retry时，失败的调用会按照重试策略在同一个连接上重试
+func (client *Client) CallContext(ctx context.Context, serviceMethod string, args, reply interface{}) error {
+	if client.opt.Retry == nil {
+		_, err := client.invoke(ctx, serviceMethod, args, reply)
+		return err
+	}
+	return client.opt.Retry.do(ctx, serviceMethod, func() (bool, bool, error) {
+		sent, err := client.invoke(ctx, serviceMethod, args, reply)
+		return sent, client.isIdempotent(serviceMethod), err
+	})
+}
+
+// invoke 发起一次调用并等待结果，不做任何重试
+// 返回请求是否已经发出，服务端可能已经执行了这次调用
+func (client *Client) invoke(ctx context.Context, serviceMethod string, args, reply interface{}) (bool, error) {
+	call := callPool.Get().(*Call)
+	call.ServiceMethod, call.Args, call.Reply = serviceMethod, args, reply
+	client.start(ctx, call)
+	select {
+	case <-ctx.Done():
+		err := fmt.Errorf("rpc client: call failed: %w", ctx.Err())
+		sent := call.sent
+		// 只有从pending中移除call的一方才能结束它，还在pending中说明done不会被调用
+		// 否则receive协程或者terminateCalls会写入Done，call不能复用
+		if c := client.removeCall(call.Seq); c == call {
+			call.finish(err)
+			call.free()
+		}
+		client.closeIfDrained()
+		return sent, err
+	case <-call.Done:
+		// 这里会堵塞，直到请求返回结果后才能接收到call实例
+		sent, err := call.sent, call.Error
+		call.free()
+		return sent, err
+	}
+}
+
+// markIdempotent 记录服务端标记为幂等的方法
+func (client *Client) markIdempotent(serviceMethod string) {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	client.idempotent[serviceMethod] = true
+}
+
+// isIdempotent 服务端是否把这个方法标记为幂等
+func (client *Client) isIdempotent(serviceMethod string) bool {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	return client.idempotent[serviceMethod]
+}
+
+// NewStream 打开一个流，serviceMethod必须是服务端注册的流方法
+// 流和普通调用复用同一个连接，通过Seq区分
+func (client *Client) NewStream(serviceMethod string) (*ClientStream, error) {
+	client.mu.Lock()
+	if client.closing || client.shutdown {
+		client.mu.Unlock()
+		return nil, ErrShutdown
+	}
+	if client.draining {
+		client.mu.Unlock()
+		return nil, ErrGoingAway
+	}
+	seq := client.seq
+	client.seq++
+	cs := &ClientStream{
+		st:            newStream(seq, client.opt.CodecType, client.writeFrame),
+		client:        client,
+		ServiceMethod: serviceMethod,
+		observe:       observeClient(client.opt.Metrics, client.target, serviceMethod),
+	}
+	client.streams[seq] = cs
+	client.mu.Unlock()
+
+	h := codec.Header{ServiceMethod: serviceMethod, Seq: seq, Frame: codec.FrameStreamOpen}
+	if t := client.opt.Tracer; t != nil {
+		// 和普通调用一样，追踪信息随打开流的报文发送，服务端的span是这个span的子span
+		var ctx context.Context
+		ctx, cs.span = startSpan(context.Background(), t, serviceMethod, SpanKindClient, string(client.opt.CodecType))
+		cs.span.SetAttribute(AttrPeerAddress, client.target)
+		h.Meta = make(map[string]string)
+		t.Inject(ctx, h.Meta)
+	}
+	if _, err := client.w.write(&h, emptyBody); err != nil {
+		client.removeStream(seq)
+		cs.end(err)
+		return nil, err
+	}
+	return cs, nil
+}
+
+func (client *Client) removeStream(seq uint64) *ClientStream {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	cs := client.streams[seq]
+	delete(client.streams, seq)
+	return cs
+}
+
+// writeFrame 完整地发送一帧流相关的报文
+// 服务端即将关闭时只是不能打开新的流，已经打开的流还要继续发送数据、结束和窗口更新
+func (client *Client) writeFrame(h *codec.Header, body interface{}) error {
+	client.mu.Lock()
+	closed := client.closing || client.shutdown
+	client.mu.Unlock()
+	if closed {
+		return ErrShutdown
+	}
+	_, err := client.w.write(h, body)
+	return err
+}
+
+// receiveFrame 处理服务端发来的流相关的报文
+// 流可能已经被关闭，此时cs为nil，报文直接丢弃
+func (client *Client) receiveFrame(h *codec.Header) error {
+	client.mu.Lock()
+	cs := client.streams[h.Seq]
+	client.mu.Unlock()
+	switch h.Frame {
+	case codec.FrameStreamData:
+		var data []byte
+		if err := client.cc.ReadBody(&data); err != nil {
+			return err
+		}
+		if cs != nil {
+			if err := cs.st.deliver(data); err != nil {
+				// 服务端不遵守流控，放弃这个流
+				cs.st.fail(err)
+				if client.removeStream(h.Seq) != nil {
+					cs.end(err)
+					// 发送队列满时写入reset会阻塞，不能让读协程等待，否则整个连接都停住了
+					reset := codec.Header{Seq: h.Seq, Frame: codec.FrameStreamReset}
+					go func() { _ = cs.st.write(&reset, emptyBody) }()
+				}
+			}
+		}
+		return nil
+	case codec.FrameStreamEnd:
+		if cs != nil {
+			client.removeStream(h.Seq)
+			var err error
+			if h.Error != "" {
+				err = errorFromHeader(h)
+			}
+			cs.finish(err)
+		}
+	case codec.FrameStreamReset:
+		if cs != nil {
+			client.removeStream(h.Seq)
+			cs.st.fail(ErrStreamReset)
+			cs.end(ErrStreamReset)
+		}
+	case codec.FrameWindow:
+		if cs != nil {
+			cs.st.addWindow(h.Window)
+		}
+	case codec.FrameGoAway:
+		if h.Error != "" {
+			// 服务端拒绝了这个连接，例如认证失败，所有的调用都以这个错误结束
+			_ = client.cc.ReadBody(nil)
+			_ = client.cc.Close()
+			return errorFromHeader(h)
+		}
+		client.mu.Lock()
+		if !client.draining {
+			client.draining = true
+			close(client.goingAway)
+		}
+		client.mu.Unlock()
+	}
+	return client.cc.ReadBody(nil)
+}
+
+// closeIfDrained 服务端即将关闭时，等所有调用和流都结束后主动断开连接
+// 服务端收到断开后才会认为这个连接已经处理完毕
+func (client *Client) closeIfDrained() {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	if client.draining && !client.closing && len(client.pending) == 0 && len(client.streams) == 0 {
+		client.closing = true
+		_ = client.cc.Close()
+	}
+}
@@ -0,0 +1,73 @@
+package geerpc
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestCloseDuringWrite 请求还在写入时连接被关闭，调用应该马上返回错误
+// 连接关闭时结束的调用不能在写入失败后再结束一次
+func TestCloseDuringWrite(t *testing.T) {
+	for i := 0; i < 50; i++ {
+		conn, peer := net.Pipe()
+		go func() {
+			// 读完option后不再读取，请求会一直阻塞在写入上
+			var opt Option
+			_ = json.NewDecoder(peer).Decode(&opt)
+		}()
+		client, err := NewClient(conn, DefaultOption)
+		if err != nil {
+			t.Fatal(err)
+		}
+		done := make(chan error, 1)
+		go func() {
+			var reply int
+			done <- client.Call("Calc.Sum", CalcArgs{Num1: 1, Num2: 2}, &reply)
+		}()
+		time.Sleep(time.Millisecond)
+		_ = peer.Close()
+		select {
+		case err := <-done:
+			if err == nil {
+				t.Fatal("expect an error")
+			}
+		case <-time.After(time.Second):
+			t.Fatal("Call hangs after the connection is closed")
+		}
+		_ = client.Close()
+	}
+}
+
+// TestCancelDuringClose 调用超时和连接关闭同时发生时，复用的Call不能带着旧的结果
+func TestCancelDuringClose(t *testing.T) {
+	addr := startServer(t, NewServer(), new(Calc))
+	for i := 0; i < 20; i++ {
+		client := dialTest(t, addr)
+		var wg sync.WaitGroup
+		for j := 0; j < 10; j++ {
+			wg.Add(1)
+			go func(j int) {
+				defer wg.Done()
+				ctx, cancel := context.WithTimeout(context.Background(), time.Duration(j)*100*time.Microsecond)
+				defer cancel()
+				var reply int
+				_ = client.CallContext(ctx, "Calc.Sum", CalcArgs{Num1: j, Num2: j}, &reply)
+			}(j)
+		}
+		time.Sleep(500 * time.Microsecond)
+		_ = client.Close()
+		wg.Wait()
+	}
+
+	client := dialTest(t, addr)
+	for i := 0; i < 100; i++ {
+		var reply int
+		if err := client.Call("Calc.Sum", CalcArgs{Num1: i, Num2: 1}, &reply); err != nil || reply != i+1 {
+			t.Fatalf("reply = %d, %v, want %d", reply, err, i+1)
+		}
+	}
+}
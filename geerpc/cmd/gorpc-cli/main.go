@@ -0,0 +1,311 @@
+// gorpc-cli 在命令行中调用geerpc服务，测试一个方法不需要再专门写一个main.go
+//
+//	gorpc-cli -addr localhost:9999 call Calc.Sum '{"Num1": 1, "Num2": 2}'
+//	gorpc-cli -addr localhost:9999 list [Service]
+//	gorpc-cli -addr localhost:9999 describe Service[.Method]
+//
+// 参数和响应都是JSON，参数为"-"时从标准输入读取。
+// list和describe需要服务端开启反射服务（geerpc.ReflectionService）；
+// 使用-codec gob时，参数和响应的类型也是通过反射服务获取的
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"geerpc"
+	"geerpc/codec"
+	"io"
+	"log"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+)
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("gorpc-cli: ")
+	if err := run(os.Args[1:], os.Stdin, os.Stdout); err != nil {
+		if err == errUsage {
+			os.Exit(2)
+		}
+		log.Fatal(err)
+	}
+}
+
+// errUsage 命令行参数错误，用法已经输出过了
+var errUsage = errors.New("usage")
+
+func run(args []string, stdin io.Reader, stdout io.Writer) error {
+	fs := flag.NewFlagSet("gorpc-cli", flag.ContinueOnError)
+	addr := fs.String("addr", "localhost:9999", "server address")
+	network := fs.String("network", "tcp", "network of the server address")
+	useHTTP := fs.Bool("http", false, "connect through HTTP CONNECT on "+geerpc.DefaultRPCPath)
+	codecName := fs.String("codec", "json", "codec: json, gob or a registered codec type")
+	timeout := fs.Duration("timeout", 10*time.Second, "timeout of the whole command")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage:\n"+
+			"  gorpc-cli [flags] call Service.Method [json|-]\n"+
+			"  gorpc-cli [flags] list [Service]\n"+
+			"  gorpc-cli [flags] describe Service[.Method]\n\nflags:\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+	cmd := fs.Args()
+	usage := func() error {
+		fs.Usage()
+		return errUsage
+	}
+	if len(cmd) == 0 {
+		return usage()
+	}
+
+	ct := codec.Type(*codecName)
+	switch *codecName {
+	case "json":
+		ct = codec.JsonType
+	case "gob":
+		ct = codec.GobType
+	}
+	if codec.NewCodecFuncMap[ct] == nil {
+		return fmt.Errorf("unknown codec %s", *codecName)
+	}
+	opt := &geerpc.Option{CodecType: ct}
+
+	dial := geerpc.Dial
+	if *useHTTP {
+		dial = geerpc.DialHTTP
+	}
+	client, err := dial(*network, *addr, opt)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = client.Close() }()
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	switch {
+	case cmd[0] == "list" && len(cmd) <= 2:
+		var name string
+		if len(cmd) == 2 {
+			name = cmd[1]
+		}
+		return list(ctx, client, name, stdout)
+	case cmd[0] == "describe" && len(cmd) == 2:
+		return describe(ctx, client, cmd[1], stdout)
+	case cmd[0] == "call" && (len(cmd) == 2 || len(cmd) == 3):
+		data := []byte("null")
+		if len(cmd) == 3 {
+			data = []byte(cmd[2])
+			if cmd[2] == "-" {
+				if data, err = io.ReadAll(stdin); err != nil {
+					return err
+				}
+			}
+		}
+		return call(ctx, client, ct, cmd[1], data, stdout)
+	}
+	return usage()
+}
+
+// list 没有指定服务时列出所有服务，否则列出服务的方法
+func list(ctx context.Context, client *geerpc.Client, name string, w io.Writer) error {
+	var services []geerpc.ServiceInfo
+	if err := client.CallContext(ctx, geerpc.ReflectionService+".List", name, &services); err != nil {
+		return err
+	}
+	for _, s := range services {
+		if name == "" {
+			fmt.Fprintln(w, s.Name)
+			continue
+		}
+		for _, m := range s.Methods {
+			if m.Stream {
+				fmt.Fprintf(w, "%s.%s (stream)\n", s.Name, m.Name)
+			} else {
+				fmt.Fprintf(w, "%s.%s\n", s.Name, m.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// describe 输出方法的签名，以及参数和响应中用到的结构体
+func describe(ctx context.Context, client *geerpc.Client, name string, w io.Writer) error {
+	var info geerpc.ServiceInfo
+	if err := client.CallContext(ctx, geerpc.ReflectionService+".Describe", name, &info); err != nil {
+		return err
+	}
+	var structs []*geerpc.TypeInfo
+	seen := make(map[string]bool)
+	for _, m := range info.Methods {
+		if m.Stream {
+			fmt.Fprintf(w, "%s.%s(stream)\n", info.Name, m.Name)
+			continue
+		}
+		fmt.Fprintf(w, "%s.%s(%s) %s\n", info.Name, m.Name, m.ArgType.Name, m.ReplyType.Name)
+		collectStructs(m.ArgType, seen, &structs)
+		collectStructs(m.ReplyType, seen, &structs)
+	}
+	for _, t := range structs {
+		fmt.Fprintf(w, "\ntype %s struct {\n", t.Name)
+		for _, f := range t.Fields {
+			if f.Tag != "" {
+				fmt.Fprintf(w, "\t%s %s `%s`\n", f.Name, f.Type.Name, f.Tag)
+			} else {
+				fmt.Fprintf(w, "\t%s %s\n", f.Name, f.Type.Name)
+			}
+		}
+		fmt.Fprintln(w, "}")
+	}
+	return nil
+}
+
+// collectStructs 按出现的顺序收集有名字的结构体，每个只收集一次
+func collectStructs(t *geerpc.TypeInfo, seen map[string]bool, out *[]*geerpc.TypeInfo) {
+	if t == nil {
+		return
+	}
+	if t.Kind == "struct" && !strings.HasPrefix(t.Name, "struct") {
+		if seen[t.Name] || len(t.Fields) == 0 {
+			// 已经收集过，或者是递归引用
+			return
+		}
+		seen[t.Name] = true
+		*out = append(*out, t)
+	}
+	collectStructs(t.Key, seen, out)
+	collectStructs(t.Elem, seen, out)
+	for _, f := range t.Fields {
+		collectStructs(f.Type, seen, out)
+	}
+}
+
+// call 发起一次调用并以JSON输出响应
+// 使用json编码时原样发送参数；其他编码需要先通过反射服务构造出参数和响应的类型
+func call(ctx context.Context, client *geerpc.Client, ct codec.Type, serviceMethod string, data []byte, w io.Writer) error {
+	// 只写服务名时Describe会返回整个服务，必须指定到方法
+	dot := strings.LastIndex(serviceMethod, ".")
+	if dot <= 0 || dot == len(serviceMethod)-1 {
+		return fmt.Errorf("%s: want Service.Method", serviceMethod)
+	}
+	if !json.Valid(data) {
+		return fmt.Errorf("invalid JSON argument: %s", data)
+	}
+	var out []byte
+	if ct == codec.JsonType {
+		var reply json.RawMessage
+		if err := client.CallContext(ctx, serviceMethod, json.RawMessage(data), &reply); err != nil {
+			return err
+		}
+		var buf bytes.Buffer
+		if err := json.Indent(&buf, reply, "", "  "); err != nil {
+			return err
+		}
+		out = buf.Bytes()
+	} else {
+		var info geerpc.ServiceInfo
+		if err := client.CallContext(ctx, geerpc.ReflectionService+".Describe", serviceMethod, &info); err != nil {
+			return fmt.Errorf("describe %s: %v", serviceMethod, err)
+		}
+		if len(info.Methods) != 1 || info.Methods[0].Name != serviceMethod[dot+1:] {
+			return fmt.Errorf("describe %s: method not found", serviceMethod)
+		}
+		m := info.Methods[0]
+		if m.Stream {
+			return fmt.Errorf("%s is a stream method", serviceMethod)
+		}
+		argType, err := typeOf(m.ArgType)
+		if err != nil {
+			return err
+		}
+		replyType, err := typeOf(m.ReplyType)
+		if err != nil {
+			return err
+		}
+		// 指针会被编码器展开，直接使用指向的类型
+		args := reflect.New(deref(argType))
+		if err := json.Unmarshal(data, args.Interface()); err != nil {
+			return err
+		}
+		reply := reflect.New(deref(replyType))
+		if err := client.CallContext(ctx, serviceMethod, args.Elem().Interface(), reply.Interface()); err != nil {
+			return err
+		}
+		if out, err = json.MarshalIndent(reply.Elem().Interface(), "", "  "); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(w, "%s\n", out)
+	return err
+}
+
+func deref(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t
+}
+
+// basicTypes 基本类型，key为reflect.Kind的名字
+var basicTypes = make(map[string]reflect.Type)
+
+func init() {
+	for _, v := range []interface{}{
+		false, "",
+		int(0), int8(0), int16(0), int32(0), int64(0),
+		uint(0), uint8(0), uint16(0), uint32(0), uint64(0), uintptr(0),
+		float32(0), float64(0), complex64(0), complex128(0),
+	} {
+		t := reflect.TypeOf(v)
+		basicTypes[t.Kind().String()] = t
+	}
+}
+
+// typeOf 根据反射服务的描述构造出结构相同的类型，编码时字段按名字匹配
+func typeOf(t *geerpc.TypeInfo) (reflect.Type, error) {
+	if bt, ok := basicTypes[t.Kind]; ok {
+		return bt, nil
+	}
+	var elem reflect.Type
+	if t.Elem != nil {
+		var err error
+		if elem, err = typeOf(t.Elem); err != nil {
+			return nil, err
+		}
+	}
+	switch t.Kind {
+	case "ptr":
+		return reflect.PointerTo(elem), nil
+	case "slice":
+		return reflect.SliceOf(elem), nil
+	case "array":
+		return reflect.ArrayOf(t.Len, elem), nil
+	case "map":
+		key, err := typeOf(t.Key)
+		if err != nil {
+			return nil, err
+		}
+		return reflect.MapOf(key, elem), nil
+	case "struct":
+		if len(t.Fields) == 0 {
+			return nil, fmt.Errorf("%s: empty or recursive struct is not supported, use -codec json", t.Name)
+		}
+		fields := make([]reflect.StructField, 0, len(t.Fields))
+		for _, f := range t.Fields {
+			ft, err := typeOf(f.Type)
+			if err != nil {
+				return nil, err
+			}
+			fields = append(fields, reflect.StructField{Name: f.Name, Type: ft, Tag: reflect.StructTag(f.Tag)})
+		}
+		return reflect.StructOf(fields), nil
+	}
+	return nil, fmt.Errorf("%s: %s is not supported, use -codec json", t.Name, t.Kind)
+}
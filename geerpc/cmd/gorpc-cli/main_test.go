@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"geerpc"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+type Calc int
+
+type Args struct {
+	Num1, Num2 int
+	Tag        string `json:"tag,omitempty"`
+}
+
+type Result struct {
+	Sum  int
+	Tags [2]string
+}
+
+func (c *Calc) Sum(args *Args, reply *Result) error {
+	reply.Sum = args.Num1 + args.Num2
+	reply.Tags[0] = args.Tag
+	return nil
+}
+
+func (c *Calc) Count(stream *geerpc.ServerStream) error { return nil }
+
+func startServer(t *testing.T) (addr, httpAddr string) {
+	server := geerpc.NewServer()
+	if err := server.Register(new(Calc)); err != nil {
+		t.Fatal(err)
+	}
+	return listen(t, server.Accept), listen(t, func(l net.Listener) {
+		mux := http.NewServeMux()
+		mux.Handle(geerpc.DefaultRPCPath, server)
+		_ = http.Serve(l, mux)
+	})
+}
+
+func listen(t *testing.T, serve func(net.Listener)) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = l.Close() })
+	go serve(l)
+	return l.Addr().String()
+}
+
+func TestRun(t *testing.T) {
+	addr, httpAddr := startServer(t)
+	sum := "{\n  \"Sum\": 3,\n  \"Tags\": [\n    \"a\",\n    \"\"\n  ]\n}\n"
+	tests := []struct {
+		args  []string
+		stdin string
+		want  string
+	}{
+		{args: []string{"list"}, want: "Calc\n_Reflection\n_rpc\n"},
+		{args: []string{"list", "Calc"}, want: "Calc.Count (stream)\nCalc.Sum\n"},
+		{args: []string{"describe", "Calc"}, want: "Calc.Count(stream)\nCalc.Sum(*main.Args) *main.Result\n\n" +
+			"type main.Args struct {\n\tNum1 int\n\tNum2 int\n\tTag string `json:\"tag,omitempty\"`\n}\n\n" +
+			"type main.Result struct {\n\tSum int\n\tTags [2]string\n}\n"},
+		{args: []string{"call", "Calc.Sum", `{"Num1": 1, "Num2": 2, "tag": "a"}`}, want: sum},
+		{args: []string{"-codec", "gob", "call", "Calc.Sum", `{"Num1": 1, "Num2": 2, "tag": "a"}`}, want: sum},
+		{args: []string{"-codec", "gob", "call", "Calc.Sum", "-"}, stdin: `{"Num1": 1, "Num2": 2, "tag": "a"}`, want: sum},
+		{args: []string{"-http", "-addr", httpAddr, "call", "Calc.Sum", `{"Num1": 1, "Num2": 2, "tag": "a"}`}, want: sum},
+	}
+	for _, tt := range tests {
+		args := append([]string{"-addr", addr}, tt.args...)
+		var out bytes.Buffer
+		if err := run(args, strings.NewReader(tt.stdin), &out); err != nil {
+			t.Errorf("%v: %v", tt.args, err)
+			continue
+		}
+		if out.String() != tt.want {
+			t.Errorf("%v:\ngot:\n%s\nwant:\n%s", tt.args, out.String(), tt.want)
+		}
+	}
+}
+
+func TestRunError(t *testing.T) {
+	addr, _ := startServer(t)
+	tests := []struct {
+		args []string
+		err  string
+	}{
+		{[]string{"call", "Calc.Sum", "{"}, "invalid JSON"},
+		{[]string{"call", "Calc.Missing", "{}"}, "can't find method"},
+		{[]string{"-codec", "gob", "call", "Calc.Count"}, "stream method"},
+		{[]string{"-codec", "xml", "list"}, "unknown codec"},
+		{[]string{"-codec", "gob", "call", "Calc", "{}"}, "want Service.Method"},
+		{[]string{"-codec", "gob", "call", "Calc.", "{}"}, "want Service.Method"},
+		{[]string{"call", ".Sum", "{}"}, "want Service.Method"},
+	}
+	for _, tt := range tests {
+		args := append([]string{"-addr", addr}, tt.args...)
+		err := run(args, strings.NewReader(""), new(bytes.Buffer))
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%v: err = %v, want %q", tt.args, err, tt.err)
+		}
+	}
+}
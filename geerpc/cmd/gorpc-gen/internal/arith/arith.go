@@ -0,0 +1,25 @@
+// Package arith 是gorpc-gen的示例，arith_gorpc.go由gorpc-gen生成
+package arith
+
+import (
+	"context"
+	"time"
+)
+
+//go:generate go run geerpc/cmd/gorpc-gen -type Arith
+
+type Args struct {
+	A, B int
+}
+
+type Quotient struct {
+	Quo, Rem int
+}
+
+// Arith 一个简单的计算服务
+type Arith interface {
+	Multiply(ctx context.Context, args *Args) (*int, error)
+	Divide(ctx context.Context, args *Args) (*Quotient, error)
+	// Sleep 参数不是指针，并且用到了其他包的类型
+	Sleep(ctx context.Context, d time.Duration) (*time.Duration, error)
+}
@@ -0,0 +1,93 @@
+// Code generated by gorpc-gen. DO NOT EDIT.
+
+package arith
+
+import (
+	"context"
+	"time"
+
+	"geerpc"
+)
+
+// ArithClient 通过geerpc调用Arith服务，参数和响应都有确定的类型
+type ArithClient struct {
+	cc geerpc.Invoker
+}
+
+// NewArithClient 创建Arith的客户端，cc可以是*geerpc.Client、*geerpc.Pool或*geerpc.ReconnectClient
+func NewArithClient(cc geerpc.Invoker) *ArithClient {
+	return &ArithClient{cc: cc}
+}
+
+var _ Arith = (*ArithClient)(nil)
+
+func (c *ArithClient) Multiply(ctx context.Context, args *Args) (*int, error) {
+	reply := new(int)
+	if err := c.cc.CallContext(ctx, "Arith.Multiply", args, reply); err != nil {
+		return nil, err
+	}
+	return reply, nil
+}
+
+func (c *ArithClient) Divide(ctx context.Context, args *Args) (*Quotient, error) {
+	reply := new(Quotient)
+	if err := c.cc.CallContext(ctx, "Arith.Divide", args, reply); err != nil {
+		return nil, err
+	}
+	return reply, nil
+}
+
+func (c *ArithClient) Sleep(ctx context.Context, args time.Duration) (*time.Duration, error) {
+	reply := new(time.Duration)
+	if err := c.cc.CallContext(ctx, "Arith.Sleep", args, reply); err != nil {
+		return nil, err
+	}
+	return reply, nil
+}
+
+var _Arith_serviceDesc = geerpc.ServiceDesc{
+	Name: "Arith",
+	Methods: []geerpc.MethodDesc{
+		{
+			Name:     "Multiply",
+			NewArgs:  func() interface{} { return new(Args) },
+			NewReply: func() interface{} { return new(int) },
+			Handler: func(srv interface{}, ctx context.Context, args interface{}) (interface{}, error) {
+				reply, err := srv.(Arith).Multiply(ctx, args.(*Args))
+				if err != nil || reply == nil {
+					return nil, err
+				}
+				return reply, nil
+			},
+		},
+		{
+			Name:     "Divide",
+			NewArgs:  func() interface{} { return new(Args) },
+			NewReply: func() interface{} { return new(Quotient) },
+			Handler: func(srv interface{}, ctx context.Context, args interface{}) (interface{}, error) {
+				reply, err := srv.(Arith).Divide(ctx, args.(*Args))
+				if err != nil || reply == nil {
+					return nil, err
+				}
+				return reply, nil
+			},
+		},
+		{
+			Name:     "Sleep",
+			NewArgs:  func() interface{} { return new(time.Duration) },
+			NewReply: func() interface{} { return new(time.Duration) },
+			Handler: func(srv interface{}, ctx context.Context, args interface{}) (interface{}, error) {
+				reply, err := srv.(Arith).Sleep(ctx, *args.(*time.Duration))
+				if err != nil || reply == nil {
+					return nil, err
+				}
+				return reply, nil
+			},
+		},
+	},
+}
+
+// RegisterArithServer 把Arith的实现注册到s，服务端直接调用impl的方法
+func RegisterArithServer(s *geerpc.Server, impl Arith, opts ...*geerpc.ServiceOption) error {
+	return s.RegisterService(&_Arith_serviceDesc, impl, opts...)
+}
@@ -0,0 +1,67 @@
+package arith
+
+import (
+	"context"
+	"errors"
+	"geerpc"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+type arith struct{}
+
+func (arith) Multiply(ctx context.Context, args *Args) (*int, error) {
+	n := args.A * args.B
+	return &n, nil
+}
+
+func (arith) Divide(ctx context.Context, args *Args) (*Quotient, error) {
+	if args.B == 0 {
+		return nil, errors.New("divide by zero")
+	}
+	return &Quotient{Quo: args.A / args.B, Rem: args.A % args.B}, nil
+}
+
+func (arith) Sleep(ctx context.Context, d time.Duration) (*time.Duration, error) {
+	return nil, nil
+}
+
+func TestArith(t *testing.T) {
+	server := geerpc.NewServer()
+	if err := RegisterArithServer(server, arith{}); err != nil {
+		t.Fatal(err)
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go server.Accept(l)
+
+	cc, err := geerpc.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cc.Close()
+	client := NewArithClient(cc)
+	ctx := context.Background()
+
+	product, err := client.Multiply(ctx, &Args{A: 6, B: 7})
+	if err != nil || *product != 42 {
+		t.Fatalf("Multiply = %v, %v", product, err)
+	}
+	q, err := client.Divide(ctx, &Args{A: 7, B: 2})
+	if err != nil || *q != (Quotient{Quo: 3, Rem: 1}) {
+		t.Fatalf("Divide = %v, %v", q, err)
+	}
+	if _, err := client.Divide(ctx, &Args{A: 1}); err == nil || !strings.Contains(err.Error(), "divide by zero") {
+		t.Fatalf("Divide by zero: err = %v", err)
+	}
+	// 实现返回nil时客户端收到零值
+	d, err := client.Sleep(ctx, time.Second)
+	if err != nil || *d != 0 {
+		t.Fatalf("Sleep = %v, %v", d, err)
+	}
+}
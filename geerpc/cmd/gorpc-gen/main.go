@@ -0,0 +1,366 @@
+// gorpc-gen 根据Go接口生成geerpc的客户端和服务端注册代码
+//
+// 接口的每个方法都必须是这样的签名：
+//
+//	Method(ctx context.Context, args A) (*R, error)
+//
+// 对于接口Foo，生成：
+//   - FooClient：实现了Foo接口的客户端，Foo.Method变成有类型的方法调用
+//   - RegisterFooServer：把Foo的实现注册到geerpc.Server，服务端直接调用方法，不需要反射
+//
+// 通常和go:generate一起使用：
+//
+//	//go:generate go run geerpc/cmd/gorpc-gen -type Foo
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("gorpc-gen: ")
+	typeNames := flag.String("type", "", "comma-separated list of interface names; must be set")
+	output := flag.String("output", "", "output file name; default <type>_gorpc.go")
+	geerpcPath := flag.String("geerpc", "geerpc", "import path of the geerpc package")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: gorpc-gen -type T [flags] [file.go ...]\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if *typeNames == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	files := flag.Args()
+	if len(files) == 0 {
+		// go:generate会通过环境变量告诉我们当前的文件
+		if f := os.Getenv("GOFILE"); f != "" {
+			files = []string{f}
+		} else {
+			flag.Usage()
+			os.Exit(2)
+		}
+	}
+	names := strings.Split(*typeNames, ",")
+	src, err := generate(files, names, *geerpcPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	out := *output
+	if out == "" {
+		out = filepath.Join(filepath.Dir(files[0]), strings.ToLower(names[0])+"_gorpc.go")
+	}
+	if err := os.WriteFile(out, src, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// service 生成代码需要的一个接口的信息
+type service struct {
+	Name    string
+	Methods []method
+}
+
+// method 接口的一个方法
+type method struct {
+	Name      string
+	Args      string // 参数的类型
+	ArgsElem  string // 参数解码的目标类型，参数不是指针时和Args相同
+	ArgsPtr   bool   // 参数是否为指针
+	Reply     string // 响应的类型，总是指针
+	ReplyElem string // 响应指向的类型
+}
+
+// generate 解析files，为names中的每个接口生成代码
+func generate(files []string, names []string, geerpcPath string) ([]byte, error) {
+	fset := token.NewFileSet()
+	var pkg string
+	parsed := make([]*ast.File, 0, len(files))
+	for _, name := range files {
+		f, err := parser.ParseFile(fset, name, nil, parser.ParseComments)
+		if err != nil {
+			return nil, err
+		}
+		if pkg != "" && f.Name.Name != pkg {
+			return nil, fmt.Errorf("files belong to different packages: %s and %s", pkg, f.Name.Name)
+		}
+		pkg = f.Name.Name
+		parsed = append(parsed, f)
+	}
+
+	imports := make(map[string]string) // 生成的代码需要的import，key为包名
+	var services []service
+	for _, name := range names {
+		f, it := findInterface(parsed, name)
+		if it == nil {
+			return nil, fmt.Errorf("interface %s not found", name)
+		}
+		svc, err := parseService(f, name, it, imports)
+		if err != nil {
+			return nil, err
+		}
+		services = append(services, svc)
+	}
+
+	geerpcName, geerpcSpec := geerpcImport(geerpcPath)
+	importList := []string{`"context"`}
+	for name, spec := range imports {
+		if name != "context" && name != geerpcName {
+			importList = append(importList, spec)
+		}
+	}
+	sort.Strings(importList)
+	var buf bytes.Buffer
+	err := fileTemplate.Execute(&buf, map[string]interface{}{
+		"Package":      pkg,
+		"Geerpc":       geerpcName,
+		"GeerpcImport": geerpcSpec,
+		"Imports":      importList,
+		"Services":     services,
+	})
+	if err != nil {
+		return nil, err
+	}
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("format generated code: %v\n%s", err, buf.Bytes())
+	}
+	return src, nil
+}
+
+func findInterface(files []*ast.File, name string) (*ast.File, *ast.InterfaceType) {
+	for _, f := range files {
+		obj := f.Scope.Lookup(name)
+		if obj == nil || obj.Kind != ast.Typ {
+			continue
+		}
+		if spec, ok := obj.Decl.(*ast.TypeSpec); ok {
+			if it, ok := spec.Type.(*ast.InterfaceType); ok {
+				return f, it
+			}
+		}
+	}
+	return nil, nil
+}
+
+// parseService 检查接口的每个方法，并记录参数和响应的类型用到的包
+func parseService(f *ast.File, name string, it *ast.InterfaceType, imports map[string]string) (service, error) {
+	svc := service{Name: name}
+	fileImports := importsOf(f)
+	for _, field := range it.Methods.List {
+		ft, ok := field.Type.(*ast.FuncType)
+		if !ok || len(field.Names) != 1 {
+			return svc, fmt.Errorf("%s: embedded interfaces are not supported", name)
+		}
+		mname := field.Names[0].Name
+		bad := func(reason string) error {
+			return fmt.Errorf("%s.%s: %s; want %s(ctx context.Context, args A) (*R, error)", name, mname, reason, mname)
+		}
+		params := flatten(ft.Params)
+		if len(params) != 2 {
+			return svc, bad("need exactly two parameters")
+		}
+		if sel, ok := params[0].(*ast.SelectorExpr); !ok || sel.Sel.Name != "Context" ||
+			fileImports[types.ExprString(sel.X)] != `"context"` {
+			return svc, bad("first parameter must be context.Context")
+		}
+		results := flatten(ft.Results)
+		if len(results) != 2 {
+			return svc, bad("need exactly two results")
+		}
+		if id, ok := results[1].(*ast.Ident); !ok || id.Name != "error" {
+			return svc, bad("second result must be error")
+		}
+		star, ok := results[0].(*ast.StarExpr)
+		if !ok {
+			return svc, bad("first result must be a pointer")
+		}
+		if !ast.IsExported(mname) {
+			return svc, bad("method must be exported")
+		}
+		m := method{
+			Name:      mname,
+			Args:      types.ExprString(params[1]),
+			ArgsElem:  types.ExprString(params[1]),
+			Reply:     types.ExprString(star),
+			ReplyElem: types.ExprString(star.X),
+		}
+		if p, ok := params[1].(*ast.StarExpr); ok {
+			m.ArgsPtr = true
+			m.ArgsElem = types.ExprString(p.X)
+		}
+		for _, expr := range []ast.Expr{params[1], star} {
+			if err := collectImports(expr, fileImports, imports); err != nil {
+				return svc, fmt.Errorf("%s.%s: %v", name, mname, err)
+			}
+		}
+		svc.Methods = append(svc.Methods, m)
+	}
+	if len(svc.Methods) == 0 {
+		return svc, fmt.Errorf("%s has no methods", name)
+	}
+	return svc, nil
+}
+
+// flatten 把"a, b int"这样合并写的参数展开
+func flatten(fl *ast.FieldList) []ast.Expr {
+	if fl == nil {
+		return nil
+	}
+	var exprs []ast.Expr
+	for _, field := range fl.List {
+		n := len(field.Names)
+		if n == 0 {
+			n = 1
+		}
+		for i := 0; i < n; i++ {
+			exprs = append(exprs, field.Type)
+		}
+	}
+	return exprs
+}
+
+// geerpcImport 返回生成的代码中引用geerpc包使用的名字和import
+// 名字取导入路径的最后一段，带有主版本号时取前一段，不是合法的包名时使用geerpc。
+// 名字和最后一段不同时以别名导入，不依赖包声明的名字
+func geerpcImport(importPath string) (name, spec string) {
+	base := path.Base(importPath)
+	name = base
+	if dir := path.Dir(importPath); isMajorVersion(base) && dir != "." {
+		name = path.Base(dir)
+	}
+	if !token.IsIdentifier(name) {
+		name = "geerpc"
+	}
+	spec = strconv.Quote(importPath)
+	if name != base {
+		spec = name + " " + spec
+	}
+	return name, spec
+}
+
+// isMajorVersion s是否是v2、v3这样的主版本号后缀
+func isMajorVersion(s string) bool {
+	if len(s) < 2 || s[0] != 'v' {
+		return false
+	}
+	n, err := strconv.Atoi(s[1:])
+	return err == nil && n >= 2 && s[1] != '0'
+}
+
+// importsOf 返回文件中每个包名对应的import
+func importsOf(f *ast.File) map[string]string {
+	m := make(map[string]string)
+	for _, spec := range f.Imports {
+		p, _ := strconv.Unquote(spec.Path.Value)
+		name := path.Base(p)
+		if spec.Name != nil {
+			name = spec.Name.Name
+		}
+		m[name] = spec.Path.Value
+	}
+	return m
+}
+
+// collectImports 记录类型表达式中用到的包
+func collectImports(expr ast.Expr, fileImports, imports map[string]string) error {
+	var err error
+	ast.Inspect(expr, func(n ast.Node) bool {
+		sel, ok := n.(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+		id, ok := sel.X.(*ast.Ident)
+		if !ok {
+			return true
+		}
+		spec, ok := fileImports[id.Name]
+		if !ok {
+			err = errors.New("unknown package " + id.Name)
+			return false
+		}
+		p, _ := strconv.Unquote(spec)
+		if path.Base(p) == id.Name {
+			imports[id.Name] = spec
+		} else {
+			imports[id.Name] = id.Name + " " + spec
+		}
+		return false
+	})
+	return err
+}
+
+var fileTemplate = template.Must(template.New("file").Parse(`// Code generated by gorpc-gen. DO NOT EDIT.
+
+package {{.Package}}
+
+import (
+{{- range .Imports}}
+	{{.}}
+{{- end}}
+
+	{{.GeerpcImport}}
+)
+{{range $svc := .Services}}
+// {{.Name}}Client 通过geerpc调用{{.Name}}服务，参数和响应都有确定的类型
+type {{.Name}}Client struct {
+	cc {{$.Geerpc}}.Invoker
+}
+
+// New{{.Name}}Client 创建{{.Name}}的客户端，cc可以是*{{$.Geerpc}}.Client、*{{$.Geerpc}}.Pool或*{{$.Geerpc}}.ReconnectClient
+func New{{.Name}}Client(cc {{$.Geerpc}}.Invoker) *{{.Name}}Client {
+	return &{{.Name}}Client{cc: cc}
+}
+
+var _ {{.Name}} = (*{{.Name}}Client)(nil)
+{{range .Methods}}
+func (c *{{$svc.Name}}Client) {{.Name}}(ctx context.Context, args {{.Args}}) ({{.Reply}}, error) {
+	reply := new({{.ReplyElem}})
+	if err := c.cc.CallContext(ctx, "{{$svc.Name}}.{{.Name}}", args, reply); err != nil {
+		return nil, err
+	}
+	return reply, nil
+}
+{{end}}
+var _{{.Name}}_serviceDesc = {{$.Geerpc}}.ServiceDesc{
+	Name: "{{.Name}}",
+	Methods: []{{$.Geerpc}}.MethodDesc{
+{{- range .Methods}}
+		{
+			Name:     "{{.Name}}",
+			NewArgs:  func() interface{} { return new({{.ArgsElem}}) },
+			NewReply: func() interface{} { return new({{.ReplyElem}}) },
+			Handler: func(srv interface{}, ctx context.Context, args interface{}) (interface{}, error) {
+				reply, err := srv.({{$svc.Name}}).{{.Name}}(ctx, {{if not .ArgsPtr}}*{{end}}args.(*{{.ArgsElem}}))
+				if err != nil || reply == nil {
+					return nil, err
+				}
+				return reply, nil
+			},
+		},
+{{- end}}
+	},
+}
+
+// Register{{.Name}}Server 把{{.Name}}的实现注册到s，服务端直接调用impl的方法
+func Register{{.Name}}Server(s *{{$.Geerpc}}.Server, impl {{.Name}}, opts ...*{{$.Geerpc}}.ServiceOption) error {
+	return s.RegisterService(&_{{.Name}}_serviceDesc, impl, opts...)
+}
+{{end}}`))
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestGolden 生成的代码必须和提交的arith_gorpc.go一致，修改生成器后需要重新go generate
+func TestGolden(t *testing.T) {
+	dir := filepath.Join("internal", "arith")
+	got, err := generate([]string{filepath.Join(dir, "arith.go")}, []string{"Arith"}, "geerpc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := os.ReadFile(filepath.Join(dir, "arith_gorpc.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("generated code differs from arith_gorpc.go, run go generate:\n%s", got)
+	}
+}
+
+func TestInvalidSignature(t *testing.T) {
+	tests := []struct {
+		method string
+		err    string
+	}{
+		{"Sum(args *Args) (*int, error)", "two parameters"},
+		{"Sum(ctx Context, args *Args) (*int, error)", "context.Context"},
+		{"Sum(ctx context.Context, args *Args) error", "two results"},
+		{"Sum(ctx context.Context, args *Args) (int, error)", "pointer"},
+		{"Sum(ctx context.Context, args *Args) (*int, bool)", "error"},
+		{"Sum(ctx context.Context, args *big.Int) (*int, error)", "unknown package big"},
+		{"io.Reader", "embedded"},
+	}
+	dir := t.TempDir()
+	for _, tt := range tests {
+		src := "package foo\n\nimport \"context\"\n\ntype Context int\n\ntype Args struct{}\n\n" +
+			"type Foo interface {\n\t" + tt.method + "\n}\n"
+		name := filepath.Join(dir, "foo.go")
+		if err := os.WriteFile(name, []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+		_, err := generate([]string{name}, []string{"Foo"}, "geerpc")
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: err = %v, want %q", tt.method, err, tt.err)
+		}
+	}
+}
+
+// TestGeerpcImport 生成的代码使用-geerpc导入路径对应的包名
+func TestGeerpcImport(t *testing.T) {
+	tests := []struct {
+		path, spec, name string
+	}{
+		{"geerpc", `"geerpc"`, "geerpc"},
+		{"example.com/x/myrpc", `"example.com/x/myrpc"`, "myrpc"},
+		{"example.com/x/myrpc/v2", `myrpc "example.com/x/myrpc/v2"`, "myrpc"},
+		{"example.com/x/go-rpc", `geerpc "example.com/x/go-rpc"`, "geerpc"},
+	}
+	file := filepath.Join("internal", "arith", "arith.go")
+	for _, tt := range tests {
+		src, err := generate([]string{file}, []string{"Arith"}, tt.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		code := string(src)
+		if !strings.Contains(code, "\n\t"+tt.spec+"\n") {
+			t.Errorf("%s: import %s not found in\n%s", tt.path, tt.spec, code)
+		}
+		if n := strings.Count(code, tt.name+".ServiceDesc{"); n != 1 {
+			t.Errorf("%s: expect the %s qualifier, got\n%s", tt.path, tt.name, code)
+		}
+		if tt.name != "geerpc" && strings.Contains(code, "geerpc.") {
+			t.Errorf("%s: hardcoded geerpc qualifier in\n%s", tt.path, code)
+		}
+	}
+}
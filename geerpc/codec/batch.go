@@ -0,0 +1,27 @@
+package codec
+
+import "io"
+
+// BatchCodec 支持批量发送的编解码器
+// 连接上的写协程把排队的多帧报文依次Encode到缓冲区，最后只Flush一次，
+// 高并发时可以把很多次系统调用合并成一次
+type BatchCodec interface {
+	Codec
+	// Encode 把一帧报文编码到缓冲区，返回这一帧编码后的字节数
+	// 缓冲区满时可能会提前发送一部分
+	Encode(h *Header, body interface{}) (int, error)
+	// Flush 发送缓冲区中所有的报文
+	Flush() error
+}
+
+// countWriter 统计编码器写入的字节数
+type countWriter struct {
+	w io.Writer
+	n int
+}
+
+func (c *countWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += n
+	return n, err
+}
@@ -4,14 +4,37 @@ import "io"
 
 // rpc请求头
 type Header struct {
-	// 服务方法
-	ServiceMethod string
-	// 序号：不同请求不同序号
-	Seq uint64
-	// 错误信息
-	Error string
+	ServiceMethod string // format "Service.Method"
+	Seq           uint64 // sequence number chosen by client
+	Error         string
+	Code          uint32 // 错误码，Error非空时有效
+
+	// 帧类型，零值表示普通的一问一答调用，兼容旧的报文
+	Frame FrameType
+	// 流控窗口增量，只在FrameWindow帧中使用
+	Window uint32
+	// 服务端注册时把这个方法标记为幂等，客户端据此判断失败后能否重试
+	Idempotent bool
+	// 服务端过载拒绝请求时，建议客户端至少等待的毫秒数
+	RetryAfter uint32
+	// 请求的元数据，例如链路追踪的traceparent
+	Meta map[string]string
 }
 
+// FrameType 标识一帧报文的用途
+// 同一个连接上可以同时存在普通调用和多个流，它们都通过Seq区分
+type FrameType uint8
+
+const (
+	FrameCall        FrameType = iota // 普通调用：一个请求对应一个响应
+	FrameStreamOpen                   // 客户端打开一个流，ServiceMethod为流方法
+	FrameStreamData                   // 流中的一条消息，body是单独编码后的消息字节
+	FrameStreamEnd                    // 发送方不再发送消息；服务端发出时表示流结束，Error为处理结果
+	FrameStreamReset                  // 任意一方放弃这个流
+	FrameWindow                       // 流控：对方可以额外发送Window条消息
+	FrameGoAway                       // 服务端即将关闭，客户端不要再发送新的请求，已经发出的请求会正常处理完
+)
+
 // 定义编/解码抽象接口
 // 所有实现此接口的编/解码器都可以替换掉默认的编/解码器
 type Codec interface {
@@ -41,4 +64,5 @@ func init() {
 
 	// 默认使用go自带的Gob解码器
 	NewCodecFuncMap[GobType] = NewGobCodec
+	NewCodecFuncMap[JsonType] = NewJsonCodec
 }
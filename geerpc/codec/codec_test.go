@@ -0,0 +1,147 @@
+package codec
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+// pipe 把写入的报文交给解码的一方读取
+type pipe struct {
+	bytes.Buffer
+}
+
+func (p *pipe) Close() error { return nil }
+
+type body struct {
+	Name  string
+	Items []int
+}
+
+var codecTypes = []Type{GobType, JsonType}
+
+// encode 用t编码一组报文，返回编码后的字节
+func encode(tb testing.TB, ct Type, frames ...interface{}) []byte {
+	var p pipe
+	cc := NewCodecFuncMap[ct](&p)
+	for i := 0; i < len(frames); i += 2 {
+		if err := cc.Write(frames[i].(*Header), frames[i+1]); err != nil {
+			tb.Fatal(err)
+		}
+	}
+	return p.Bytes()
+}
+
+func newReader(ct Type, data []byte, l Limits) Codec {
+	p := &pipe{}
+	p.Write(data)
+	cc := NewCodecFuncMap[ct](p)
+	cc.(LimitedCodec).SetLimits(l)
+	return cc
+}
+
+func TestLimits(t *testing.T) {
+	large := body{Name: strings.Repeat("x", 4096)}
+	for _, ct := range codecTypes {
+		t.Run(string(ct), func(t *testing.T) {
+			data := encode(t, ct,
+				&Header{ServiceMethod: "Foo.Sum", Seq: 1}, body{Name: "small"},
+				&Header{ServiceMethod: "Foo.Sum", Seq: 2}, large,
+				&Header{ServiceMethod: "Foo.Sum", Seq: 3}, body{Name: "after"})
+			cc := newReader(ct, data, Limits{MaxHeaderSize: 1024, MaxBodySize: 1024})
+
+			var h Header
+			var b body
+			if err := cc.ReadHeader(&h); err != nil || h.Seq != 1 {
+				t.Fatalf("read header: %v %+v", err, h)
+			}
+			if err := cc.ReadBody(&b); err != nil || b.Name != "small" {
+				t.Fatalf("read body: %v %+v", err, b)
+			}
+			if err := cc.ReadHeader(&h); err != nil || h.Seq != 2 {
+				t.Fatalf("read header: %v %+v", err, h)
+			}
+			if err := cc.ReadBody(&b); !errors.Is(err, ErrTooLarge) {
+				t.Fatalf("expect ErrTooLarge, got %v", err)
+			}
+			// 超大的body被丢弃，下一帧可以正常读取
+			if err := cc.ReadHeader(&h); err != nil || h.Seq != 3 {
+				t.Fatalf("read header after too large: %v %+v", err, h)
+			}
+			if err := cc.ReadBody(&b); err != nil || b.Name != "after" {
+				t.Fatalf("read body after too large: %v %+v", err, b)
+			}
+		})
+	}
+}
+
+func TestLimitsHeader(t *testing.T) {
+	for _, ct := range codecTypes {
+		data := encode(t, ct, &Header{ServiceMethod: strings.Repeat("x", 8192)}, body{})
+		cc := newReader(ct, data, Limits{MaxHeaderSize: 1024})
+		var h Header
+		if err := cc.ReadHeader(&h); !errors.Is(err, ErrTooLarge) {
+			t.Fatalf("%s: expect ErrTooLarge, got %v", ct, err)
+		}
+	}
+}
+
+func TestLimitsDepth(t *testing.T) {
+	data := encode(t, JsonType, &Header{Seq: 1}, nil)
+	data = append(data, strings.Repeat("[", 20)+strings.Repeat("]", 20)+"\n"...)
+	cc := newReader(JsonType, data, Limits{MaxDepth: 10})
+	var h Header
+	if err := cc.ReadHeader(&h); err != nil {
+		t.Fatal(err)
+	}
+	// 丢弃的body也要检查
+	_ = cc.ReadBody(nil)
+	if err := cc.ReadBody(nil); !errors.Is(err, ErrTooDeep) {
+		t.Fatalf("expect ErrTooDeep, got %v", err)
+	}
+}
+
+// fuzz 任意输入都不能导致panic，并且读取的字节数不能超过限制
+func fuzz(f *testing.F, ct Type, read func(cc Codec) error) {
+	f.Add(encode(f, ct, &Header{ServiceMethod: "Foo.Sum", Seq: 1, Meta: map[string]string{"k": "v"}}, body{Name: "a", Items: []int{1, 2}}))
+	f.Add(encode(f, ct, &Header{Seq: 2, Error: "err", Frame: FrameStreamData}, []byte("data")))
+	f.Add([]byte{})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		l := Limits{MaxHeaderSize: 256, MaxBodySize: 256, MaxDepth: 8}
+		p := &pipe{}
+		p.Write(data)
+		cc := NewCodecFuncMap[ct](p)
+		cc.(LimitedCodec).SetLimits(l)
+		for i := 0; i < 4; i++ {
+			before := p.Len()
+			err := read(cc)
+			if n := before - p.Len(); n > 2*(256+jsonReadAhead) {
+				t.Fatalf("read %d bytes, over the limit", n)
+			}
+			if err == io.EOF || errors.Is(err, ErrTooLarge) {
+				return
+			}
+		}
+	})
+}
+
+func readFrame(cc Codec) error {
+	var h Header
+	if err := cc.ReadHeader(&h); err != nil {
+		return err
+	}
+	var b body
+	return cc.ReadBody(&b)
+}
+
+func readHeader(cc Codec) error {
+	var h Header
+	return cc.ReadHeader(&h)
+}
+
+func FuzzGobReadHeader(f *testing.F)  { fuzz(f, GobType, readHeader) }
+func FuzzGobReadBody(f *testing.F)    { fuzz(f, GobType, readFrame) }
+func FuzzJsonReadHeader(f *testing.F) { fuzz(f, JsonType, readHeader) }
+func FuzzJsonReadBody(f *testing.F)   { fuzz(f, JsonType, readFrame) }
@@ -3,59 +3,164 @@ package codec
 import (
 	"bufio"
 	"encoding/gob"
+	"fmt"
 	"io"
-	"log"
 )
 
 type GobCodec struct {
-	conn io.ReadWriteCloser
-	buf  *bufio.Writer
-	dec  *gob.Decoder
-	enc  *gob.Encoder
+	conn   io.ReadWriteCloser
+	r      *limitReader
+	f      *gobFramer // 记录报文边界，body超过限制时用来丢弃剩下的部分
+	buf    *bufio.Writer
+	w      *countWriter // 包装buf，统计每一帧的字节数
+	dec    *gob.Decoder
+	enc    *gob.Encoder
+	limits Limits
 }
 
 // 这里利用强制类型转换，确保GobCodec已经实现Codec接口
 // 如果没有实现Codec接口，编译阶段就会报错
-var _ Codec = (*GobCodec)(nil)
+var (
+	_ LimitedCodec = (*GobCodec)(nil)
+	_ BatchCodec   = (*GobCodec)(nil)
+)
 
 func NewGobCodec(conn io.ReadWriteCloser) Codec {
 	buf := bufio.NewWriter(conn)
+	// gob每次只读取一帧报文的字节，底层没有缓冲时自己加一层
+	var r io.Reader = conn
+	if _, ok := conn.(io.ByteReader); !ok {
+		r = bufio.NewReader(conn)
+	}
+	f := &gobFramer{r: r}
+	lr := newLimitReader(f)
+	w := &countWriter{w: buf}
 	return &GobCodec{
-		conn: conn,
-		buf:  buf,
-		dec:  gob.NewDecoder(conn),
-		enc:  gob.NewEncoder(buf),
+		conn:   conn,
+		r:      lr,
+		f:      f,
+		buf:    buf,
+		w:      w,
+		dec:    gob.NewDecoder(lr),
+		enc:    gob.NewEncoder(w),
+		limits: Limits{MaxHeaderSize: -1, MaxBodySize: -1, MaxDepth: -1},
 	}
 }
 
+func (c *GobCodec) SetLimits(l Limits) {
+	c.limits = l.withDefaults()
+}
+
 func (c *GobCodec) ReadHeader(h *Header) error {
-	return c.dec.Decode(h)
+	c.r.allow(c.limits.MaxHeaderSize)
+	return c.r.check(c.dec.Decode(h))
 }
 
+// ReadBody 读取body，超过大小限制时丢弃这条报文剩下的字节后返回ErrTooLarge，
+// 连接上的数据不会错位，可以继续读取下一帧
 func (c *GobCodec) ReadBody(body interface{}) error {
-	return c.dec.Decode(body)
+	c.r.allow(c.limits.MaxBodySize)
+	err := c.r.check(c.dec.Decode(body))
+	if err == ErrTooLarge && c.f.skip() == nil {
+		c.r.resume()
+	}
+	return err
 }
 
-// 将要返回给客户端的内容，写入缓冲区
-//
-func (c *GobCodec) Write(h *Header, body interface{}) (err error) {
+// Encode 将一帧报文编码到缓冲区，出错时关闭连接
+func (c *GobCodec) Encode(h *Header, body interface{}) (n int, err error) {
+	start := c.w.n
 	defer func() {
-		_ = c.buf.Flush()
 		if err != nil {
 			_ = c.Close()
 		}
 	}()
+	// 错误交给调用方处理，编解码器本身不输出日志
 	if err := c.enc.Encode(h); err != nil {
-		log.Println("rpc codec: gob error encoding header:", err)
-		return err
+		return 0, fmt.Errorf("rpc codec: gob error encoding header: %w", err)
 	}
 	if err := c.enc.Encode(body); err != nil {
-		log.Println("rpc codec: gob error encoding body:", err)
+		return 0, fmt.Errorf("rpc codec: gob error encoding body: %w", err)
+	}
+	return c.w.n - start, nil
+}
+
+// Flush 发送缓冲区中的报文，出错时关闭连接
+func (c *GobCodec) Flush() error {
+	if err := c.buf.Flush(); err != nil {
+		_ = c.Close()
 		return err
 	}
 	return nil
 }
 
+// 将要返回给客户端的内容，写入缓冲区并立即发送
+func (c *GobCodec) Write(h *Header, body interface{}) error {
+	if _, err := c.Encode(h, body); err != nil {
+		return err
+	}
+	return c.Flush()
+}
+
 func (c *GobCodec) Close() error {
 	return c.conn.Close()
-}
\ No newline at end of file
+}
+
+// gobFramer 跟踪gob消息的边界
+// gob的每条消息都以长度开头，gob.Decoder不会提前读取，所以经过这里的字节就是解码器读取的字节
+type gobFramer struct {
+	r    io.Reader
+	need int    // 长度前缀还没读取的字节数
+	size uint64 // 正在读取的长度前缀
+	left int64  // 当前消息还没读取的字节数
+}
+
+func (f *gobFramer) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if f.left == 0 {
+		// 长度前缀逐个字节读取，这样才能知道消息内容从哪里开始
+		p = p[:1]
+	} else if int64(len(p)) > f.left {
+		p = p[:f.left]
+	}
+	n, err := f.r.Read(p)
+	if f.left > 0 {
+		f.left -= int64(n)
+	} else if n == 1 {
+		f.feed(p[0])
+	}
+	return n, err
+}
+
+// feed 解析长度前缀，格式见encoding/gob的无符号整数编码
+func (f *gobFramer) feed(b byte) {
+	if f.need == 0 {
+		if b < 0x80 {
+			f.left = int64(b)
+			return
+		}
+		f.need, f.size = 256-int(b), 0
+		return
+	}
+	f.size = f.size<<8 | uint64(b)
+	if f.need--; f.need == 0 {
+		f.left = int64(f.size)
+	}
+}
+
+// skip 丢弃解码器读取到一半的消息
+// 解码器正好停在两条消息之间时，说明超过限制的是下一条消息，把它整个丢弃
+func (f *gobFramer) skip() error {
+	var b [1]byte
+	for start := f.need == 0 && f.left == 0; start || f.need > 0; start = false {
+		if _, err := io.ReadFull(f.r, b[:]); err != nil {
+			return err
+		}
+		f.feed(b[0])
+	}
+	n, err := io.CopyN(io.Discard, f.r, f.left)
+	f.left -= n
+	return err
+}
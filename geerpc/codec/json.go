@@ -0,0 +1,146 @@
+package codec
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// jsonReadAhead json.Decoder会提前读取后面的数据到缓冲区，
+// 允许读取的字节数要在限制的基础上多留出这么多
+const jsonReadAhead = 4 << 10
+
+type JsonCodec struct {
+	conn   io.ReadWriteCloser
+	r      *limitReader
+	buf    *bufio.Writer
+	w      *countWriter
+	dec    *json.Decoder
+	base   int64 // dec开始解码的位置在连接上的偏移量，丢弃超大报文后会换新的dec
+	enc    *json.Encoder
+	limits Limits
+}
+
+var (
+	_ LimitedCodec = (*JsonCodec)(nil)
+	_ BatchCodec   = (*JsonCodec)(nil)
+)
+
+func NewJsonCodec(conn io.ReadWriteCloser) Codec {
+	buf := bufio.NewWriter(conn)
+	r := newLimitReader(conn)
+	w := &countWriter{w: buf}
+	return &JsonCodec{
+		conn:   conn,
+		r:      r,
+		buf:    buf,
+		w:      w,
+		dec:    json.NewDecoder(r),
+		enc:    json.NewEncoder(w),
+		limits: Limits{MaxHeaderSize: -1, MaxBodySize: -1, MaxDepth: -1},
+	}
+}
+
+func (c *JsonCodec) SetLimits(l Limits) {
+	c.limits = l.withDefaults()
+}
+
+// read 先把一个JSON值完整读成字节，检查大小和嵌套深度后再解码到v中，v为nil时直接丢弃
+func (c *JsonCodec) read(v interface{}, size int) error {
+	if size >= 0 {
+		c.r.allowUntil(c.base+c.dec.InputOffset(), size+jsonReadAhead)
+	} else {
+		c.r.allow(-1)
+	}
+	var raw json.RawMessage
+	if err := c.dec.Decode(&raw); err != nil {
+		return c.r.check(err)
+	}
+	if size >= 0 && len(raw) > size {
+		return ErrTooLarge
+	}
+	if err := checkDepth(raw, c.limits.MaxDepth); err != nil {
+		return err
+	}
+	if v == nil {
+		return nil
+	}
+	return json.Unmarshal(raw, v)
+}
+
+func (c *JsonCodec) ReadHeader(h *Header) error {
+	return c.read(h, c.limits.MaxHeaderSize)
+}
+
+// ReadBody 读取body，超过大小限制时丢弃这条报文剩下的字节后返回ErrTooLarge，
+// 连接上的数据不会错位，可以继续读取下一帧
+func (c *JsonCodec) ReadBody(body interface{}) error {
+	err := c.read(body, c.limits.MaxBodySize)
+	if err == ErrTooLarge && c.r.err != nil {
+		_ = c.skip()
+	}
+	return err
+}
+
+// skip 丢弃读取到一半的报文
+// json.Encoder在每个值后面都会写一个换行符，丢弃到换行符为止，然后换一个新的解码器
+func (c *JsonCodec) skip() error {
+	rest, _ := io.ReadAll(c.dec.Buffered())
+	var buf []byte
+	for {
+		if i := bytes.IndexByte(rest, '\n'); i >= 0 {
+			rest = rest[i+1:]
+			break
+		}
+		if buf == nil {
+			buf = make([]byte, jsonReadAhead)
+		}
+		n, err := c.r.r.Read(buf)
+		if n == 0 && err != nil {
+			return err
+		}
+		rest = buf[:n]
+	}
+	c.r.resume()
+	// rest是下一帧开头已经读取的字节，新的解码器先读取它们
+	c.base = c.r.n - int64(len(rest))
+	c.dec = json.NewDecoder(io.MultiReader(bytes.NewReader(rest), c.r))
+	return nil
+}
+
+func (c *JsonCodec) Encode(h *Header, body interface{}) (n int, err error) {
+	start := c.w.n
+	defer func() {
+		if err != nil {
+			_ = c.Close()
+		}
+	}()
+	if err := c.enc.Encode(h); err != nil {
+		return 0, fmt.Errorf("rpc codec: json error encoding header: %w", err)
+	}
+	if err := c.enc.Encode(body); err != nil {
+		return 0, fmt.Errorf("rpc codec: json error encoding body: %w", err)
+	}
+	return c.w.n - start, nil
+}
+
+func (c *JsonCodec) Flush() error {
+	if err := c.buf.Flush(); err != nil {
+		_ = c.Close()
+		return err
+	}
+	return nil
+}
+
+func (c *JsonCodec) Write(h *Header, body interface{}) error {
+	if _, err := c.Encode(h, body); err != nil {
+		return err
+	}
+	return c.Flush()
+}
+
+func (c *JsonCodec) Close() error {
+	return c.conn.Close()
+}
@@ -0,0 +1,178 @@
+package codec
+
+import (
+	"errors"
+	"io"
+)
+
+var (
+	// ErrTooLarge 报文超过了Limits中的大小限制
+	// body超过限制时，编解码器会丢弃这条报文剩下的字节，之后可以继续读取下一帧；
+	// header超过限制时连接上的数据已经错位，之后的读取都会返回这个错误
+	ErrTooLarge = errors.New("rpc codec: message too large")
+	// ErrTooDeep 报文的嵌套深度超过了Limits.MaxDepth
+	ErrTooDeep = errors.New("rpc codec: message nested too deeply")
+)
+
+// Limits 限制读取的每一帧报文，避免对方发送超大的报文耗尽内存
+// 字段为0时使用DefaultLimits中的值，小于0表示不限制
+type Limits struct {
+	MaxHeaderSize int // header的最大字节数
+	MaxBodySize   int // body的最大字节数
+	// body的最大嵌套深度，只对JSON有效
+	// gob只能解码到事先声明的类型，嵌套深度由这些类型决定
+	MaxDepth int
+}
+
+var DefaultLimits = Limits{
+	MaxHeaderSize: 64 << 10,
+	MaxBodySize:   4 << 20,
+	MaxDepth:      100,
+}
+
+// withDefaults 用默认值补全为0的字段
+func (l Limits) withDefaults() Limits {
+	if l.MaxHeaderSize == 0 {
+		l.MaxHeaderSize = DefaultLimits.MaxHeaderSize
+	}
+	if l.MaxBodySize == 0 {
+		l.MaxBodySize = DefaultLimits.MaxBodySize
+	}
+	if l.MaxDepth == 0 {
+		l.MaxDepth = DefaultLimits.MaxDepth
+	}
+	return l
+}
+
+// LimitedCodec 支持限制报文大小的编解码器
+// 创建连接时服务端和客户端会检查编解码器是否实现了这个接口
+type LimitedCodec interface {
+	Codec
+	SetLimits(Limits)
+}
+
+// limitReader 在解码器和连接之间限制可以读取的字节数
+// 解码器分配的内存不会超过允许读取的字节数
+type limitReader struct {
+	r   io.Reader
+	br  io.ByteReader // r实现了io.ByteReader时不为nil
+	n   int64         // 一共读取的字节数
+	max int64         // n的上限，小于0表示不限制
+	err error         // 超过上限后一直返回ErrTooLarge
+}
+
+func newLimitReader(r io.Reader) *limitReader {
+	br, _ := r.(io.ByteReader)
+	return &limitReader{r: r, br: br, max: -1}
+}
+
+// allow 从现在开始最多还可以读取size个字节，size小于0表示不限制
+func (l *limitReader) allow(size int) {
+	l.allowUntil(l.n, size)
+}
+
+// allowUntil 从偏移量offset开始最多读取size个字节
+func (l *limitReader) allowUntil(offset int64, size int) {
+	if size < 0 {
+		l.max = -1
+		return
+	}
+	l.max = offset + int64(size)
+}
+
+// remaining 还可以读取的字节数，小于0表示不限制
+func (l *limitReader) remaining() int64 {
+	if l.max < 0 {
+		return -1
+	}
+	if l.n >= l.max {
+		l.err = ErrTooLarge
+		return 0
+	}
+	return l.max - l.n
+}
+
+func (l *limitReader) Read(p []byte) (int, error) {
+	if l.err != nil {
+		return 0, l.err
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if r := l.remaining(); r == 0 {
+		return 0, l.err
+	} else if r > 0 && int64(len(p)) > r {
+		p = p[:r]
+	}
+	n, err := l.r.Read(p)
+	l.n += int64(n)
+	return n, err
+}
+
+// ReadByte gob.Decoder发现io.ByteReader时不会再套一层缓冲，
+// 保证它不会提前读取下一帧报文
+func (l *limitReader) ReadByte() (byte, error) {
+	if l.br == nil {
+		var b [1]byte
+		_, err := io.ReadFull(l, b[:])
+		return b[0], err
+	}
+	if l.err != nil {
+		return 0, l.err
+	}
+	if l.remaining() == 0 {
+		return 0, l.err
+	}
+	b, err := l.br.ReadByte()
+	if err == nil {
+		l.n++
+	}
+	return b, err
+}
+
+// resume 超过限制的报文已经被丢弃，恢复读取
+func (l *limitReader) resume() {
+	l.err = nil
+}
+
+// check 解码失败时，如果是因为超过了限制，返回ErrTooLarge
+func (l *limitReader) check(err error) error {
+	if l.err != nil {
+		return l.err
+	}
+	return err
+}
+
+// checkDepth 检查JSON的嵌套深度是否超过max
+func checkDepth(data []byte, max int) error {
+	if max < 0 {
+		return nil
+	}
+	depth := 0
+	inString, escaped := false, false
+	for _, c := range data {
+		if inString {
+			switch {
+			case escaped:
+				escaped = false
+			case c == '\\':
+				escaped = true
+			case c == '"':
+				inString = false
+			}
+			continue
+		}
+		switch c {
+		case '"':
+			inString = true
+		case '[', '{':
+			depth++
+			if depth > max {
+				return ErrTooDeep
+			}
+		case ']', '}':
+			depth--
+		}
+	}
+	return nil
+}
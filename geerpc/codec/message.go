@@ -0,0 +1,43 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+)
+
+// 流中的每条消息都先单独编码成字节，再作为body发送
+// 这样读取报文的协程不需要知道消息的具体类型，可以先把字节缓存起来，
+// 等到处理方调用Recv时再解码，某个流处理得慢也不会阻塞整个连接
+
+// Marshal 使用指定的编码类型，将v单独编码成字节
+func Marshal(t Type, v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := MarshalTo(t, &buf, v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// MarshalTo 和Marshal一样，编码的结果追加到buf中，调用方可以复用buf
+func MarshalTo(t Type, buf *bytes.Buffer, v interface{}) error {
+	switch t {
+	case GobType:
+		return gob.NewEncoder(buf).Encode(v)
+	case JsonType:
+		return json.NewEncoder(buf).Encode(v)
+	}
+	return fmt.Errorf("rpc codec: invalid codec type %s", t)
+}
+
+// Unmarshal 将Marshal得到的字节解码到v中，v必须是指针
+func Unmarshal(t Type, data []byte, v interface{}) error {
+	switch t {
+	case GobType:
+		return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+	case JsonType:
+		return json.Unmarshal(data, v)
+	}
+	return fmt.Errorf("rpc codec: invalid codec type %s", t)
+}
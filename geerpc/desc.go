@@ -0,0 +1,88 @@
+package geerpc
+
+import (
+	"context"
+	"fmt"
+	"go/ast"
+	"reflect"
+	"strings"
+)
+
+// Invoker 发起一次调用，*Client、*Pool和*ReconnectClient都实现了这个接口
+// gorpc-gen生成的客户端通过它发送请求
+type Invoker interface {
+	CallContext(ctx context.Context, serviceMethod string, args, reply interface{}) error
+}
+
+var (
+	_ Invoker = (*Client)(nil)
+	_ Invoker = (*Pool)(nil)
+	_ Invoker = (*ReconnectClient)(nil)
+)
+
+// ServiceDesc 描述一个服务，通常由gorpc-gen根据Go接口生成
+// 通过RegisterService注册的服务直接调用方法，不需要反射
+type ServiceDesc struct {
+	Name    string
+	Methods []MethodDesc
+}
+
+// MethodDesc 描述服务的一个方法
+type MethodDesc struct {
+	Name string
+	// NewArgs 返回一个新的参数指针，请求的body解码到这里
+	NewArgs func() interface{}
+	// NewReply 返回一个新的响应指针，Handler返回nil时发送它
+	NewReply func() interface{}
+	// Handler 调用srv上的方法，srv是注册时传入的实现，args是NewArgs返回的值
+	Handler func(srv interface{}, ctx context.Context, args interface{}) (interface{}, error)
+}
+
+// newDescService 根据ServiceDesc创建服务
+func newDescService(desc *ServiceDesc, impl interface{}) (*service, error) {
+	if !ast.IsExported(desc.Name) || strings.Contains(desc.Name, ".") {
+		return nil, fmt.Errorf("rpc server: %s is not a valid service name", desc.Name)
+	}
+	if impl == nil {
+		return nil, fmt.Errorf("rpc server: nil implementation for service %s", desc.Name)
+	}
+	s := &service{
+		name:   desc.Name,
+		typ:    reflect.TypeOf(impl),
+		rcvr:   reflect.ValueOf(impl),
+		impl:   impl,
+		method: make(map[string]*methodType, len(desc.Methods)),
+	}
+	for _, md := range desc.Methods {
+		if md.NewArgs == nil || md.NewReply == nil || md.Handler == nil {
+			return nil, fmt.Errorf("rpc server: method %s.%s is incomplete", desc.Name, md.Name)
+		}
+		if _, dup := s.method[md.Name]; dup {
+			return nil, fmt.Errorf("rpc server: method %s.%s is defined twice", desc.Name, md.Name)
+		}
+		s.method[md.Name] = &methodType{
+			method:    reflect.Method{Name: md.Name},
+			ArgType:   reflect.TypeOf(md.NewArgs()),
+			ReplyType: reflect.TypeOf(md.NewReply()),
+			newArgs:   md.NewArgs,
+			newReply:  md.NewReply,
+			handler:   md.Handler,
+		}
+	}
+	return s, nil
+}
+
+// RegisterService 注册一个由ServiceDesc描述的服务，impl是服务的实现
+// 和Register共用同一个服务表、统计和方法配置
+func (server *Server) RegisterService(desc *ServiceDesc, impl interface{}, opts ...*ServiceOption) error {
+	s, err := newDescService(desc, impl)
+	if err != nil {
+		return err
+	}
+	return server.register(s, opts...)
+}
+
+// RegisterService 在DefaultServer上注册一个由ServiceDesc描述的服务
+func RegisterService(desc *ServiceDesc, impl interface{}, opts ...*ServiceOption) error {
+	return DefaultServer.RegisterService(desc, impl, opts...)
+}
@@ -0,0 +1,115 @@
+package geerpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"geerpc/codec"
+	"io"
+	"net"
+	"time"
+)
+
+// Code 错误码，随响应头一起发送给客户端
+// 取值和gRPC的状态码保持一致
+type Code uint32
+
+const (
+	CodeOK                Code = 0
+	CodeCanceled          Code = 1
+	CodeUnknown           Code = 2
+	CodeInvalidArgument   Code = 3
+	CodeDeadlineExceeded  Code = 4
+	CodeNotFound          Code = 5
+	CodePermissionDenied  Code = 7
+	CodeResourceExhausted Code = 8
+	CodeInternal          Code = 13
+	CodeUnavailable       Code = 14
+	CodeUnauthenticated   Code = 16
+)
+
+var codeNames = map[Code]string{
+	CodeOK:                "OK",
+	CodeCanceled:          "Canceled",
+	CodeUnknown:           "Unknown",
+	CodeInvalidArgument:   "InvalidArgument",
+	CodeDeadlineExceeded:  "DeadlineExceeded",
+	CodeNotFound:          "NotFound",
+	CodePermissionDenied:  "PermissionDenied",
+	CodeResourceExhausted: "ResourceExhausted",
+	CodeInternal:          "Internal",
+	CodeUnavailable:       "Unavailable",
+	CodeUnauthenticated:   "Unauthenticated",
+}
+
+func (c Code) String() string {
+	if name, ok := codeNames[c]; ok {
+		return name
+	}
+	return fmt.Sprintf("Code(%d)", uint32(c))
+}
+
+// Error 带错误码的错误
+// 服务方法返回*Error时，错误码会原样发送给客户端，否则错误码为CodeUnknown
+type Error struct {
+	Code    Code
+	Message string
+	// 服务端过载时建议的重试等待时间
+	// 非零表示请求在执行之前就被拒绝了，即使方法不是幂等的也可以放心重试
+	RetryAfter time.Duration
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Errorf 创建一个带错误码的错误
+func Errorf(code Code, format string, a ...interface{}) error {
+	return &Error{Code: code, Message: fmt.Sprintf(format, a...)}
+}
+
+// CodeOf 返回err对应的错误码
+// 连接断开之类的错误认为是CodeUnavailable
+func CodeOf(err error) Code {
+	if err == nil {
+		return CodeOK
+	}
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Code
+	}
+	var ne net.Error
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return CodeDeadlineExceeded
+	case errors.Is(err, context.Canceled):
+		return CodeCanceled
+	case errors.Is(err, ErrShutdown), errors.Is(err, io.EOF),
+		errors.Is(err, io.ErrUnexpectedEOF), errors.As(err, &ne):
+		return CodeUnavailable
+	}
+	return CodeUnknown
+}
+
+// errorFromHeader 根据响应头中的错误信息还原出错误
+func errorFromHeader(h *codec.Header) error {
+	c := Code(h.Code)
+	if c == CodeOK {
+		// 对方没有设置错误码
+		c = CodeUnknown
+	}
+	return &Error{
+		Code:       c,
+		Message:    h.Error,
+		RetryAfter: time.Duration(h.RetryAfter) * time.Millisecond,
+	}
+}
+
+// retryAfterOf 返回服务端建议的重试等待时间
+func retryAfterOf(err error) time.Duration {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.RetryAfter
+	}
+	return 0
+}
@@ -1 +1,3 @@
-module "geerpc"
\ No newline at end of file
+module geerpc
+
+go 1.18
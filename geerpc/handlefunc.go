@@ -0,0 +1,83 @@
+package geerpc
+
+import (
+	"errors"
+	"fmt"
+	"go/token"
+	"reflect"
+	"strings"
+)
+
+// HandleFunc 把函数fn注册为serviceMethod（格式为Service.Method）的处理函数，
+// 不需要为了几个方法专门定义一个结构体。fn的签名和服务方法相同，只是没有接收者：
+//
+//	func(ctx context.Context, args T1, reply *T2) error
+//	func(args T1, reply *T2) error
+//	func(stream *ServerStream) error
+//
+// 同一个服务名下可以注册多个函数，但不能和Register注册的服务同名
+// 函数和结构体的方法共用同一个服务表和统计，opts可以对这个方法做额外的配置，最多只能传一个
+func (server *Server) HandleFunc(serviceMethod string, fn interface{}, opts ...*MethodOption) error {
+	dot := strings.Index(serviceMethod, ".")
+	if dot < 0 {
+		return fmt.Errorf("rpc: service/method ill-formed: %s", serviceMethod)
+	}
+	serviceName, methodName := serviceMethod[:dot], serviceMethod[dot+1:]
+	if !token.IsIdentifier(serviceName) || !token.IsExported(serviceName) {
+		return fmt.Errorf("rpc server: %s is not a valid service name", serviceName)
+	}
+	if !token.IsIdentifier(methodName) || !token.IsExported(methodName) {
+		return fmt.Errorf("rpc server: %s is not a valid method name", methodName)
+	}
+	if len(opts) > 1 {
+		return errors.New("rpc: number of method options is more than 1")
+	}
+	fv := reflect.ValueOf(fn)
+	if fv.Kind() != reflect.Func || fv.IsNil() {
+		return fmt.Errorf("rpc server: %s: handler is not a function", serviceMethod)
+	}
+	m := newMethodType(fv.Type(), 0)
+	if m == nil {
+		return fmt.Errorf("rpc server: %s: invalid handler signature %s", serviceMethod, fv.Type())
+	}
+	m.method = reflect.Method{Name: methodName, Type: fv.Type()}
+	m.fn = fv
+	if len(opts) == 1 {
+		m.applyOption(opts[0])
+	}
+
+	// 服务表是并发读取的，添加方法时复制一份新的服务替换旧的
+	// 只有HandleFunc会修改函数服务，加锁后替换不会丢失其他协程添加的方法
+	server.funcMu.Lock()
+	defer server.funcMu.Unlock()
+	old, ok := server.serviceMap.Load(serviceName)
+	if !ok {
+		s := &service{name: serviceName, method: map[string]*methodType{methodName: m}, funcs: true}
+		if _, dup := server.serviceMap.LoadOrStore(serviceName, s); dup {
+			// Register刚刚注册了同名的服务
+			return errors.New("rpc: service already defined: " + serviceName)
+		}
+	} else {
+		s := old.(*service)
+		if !s.funcs {
+			return errors.New("rpc: service already defined: " + serviceName)
+		}
+		if s.method[methodName] != nil {
+			return errors.New("rpc: method already defined: " + serviceMethod)
+		}
+		ns := &service{name: serviceName, method: make(map[string]*methodType, len(s.method)+1), funcs: true}
+		for name, mt := range s.method {
+			ns.method[name] = mt
+		}
+		ns.method[methodName] = m
+		server.serviceMap.Store(serviceName, ns)
+	}
+	server.logger.Log(LevelDebug, "rpc server: register",
+		LogKeyMethod, serviceMethod, "stream", m.streaming)
+	return nil
+}
+
+// HandleFunc 在DefaultServer上注册一个处理函数
+func HandleFunc(serviceMethod string, fn interface{}, opts ...*MethodOption) error {
+	return DefaultServer.HandleFunc(serviceMethod, fn, opts...)
+}
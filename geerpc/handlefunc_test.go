@@ -0,0 +1,111 @@
+package geerpc
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestHandleFunc(t *testing.T) {
+	server := NewServer()
+	var base int
+	add := func(ctx context.Context, args CalcArgs, reply *int) error {
+		*reply = base + args.Num1 + args.Num2
+		return nil
+	}
+	if err := server.HandleFunc("Math.Add", add); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.HandleFunc("Math.Neg", func(n int, reply *int) error {
+		*reply = -n
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.HandleFunc("Math.Count", func(stream *ServerStream) error {
+		var n int
+		for {
+			var v int
+			if err := stream.Recv(&v); err == io.EOF {
+				return stream.Send(n)
+			} else if err != nil {
+				return err
+			}
+			n++
+		}
+	}); err != nil {
+		t.Fatal(err)
+	}
+	client := dialTest(t, startServer(t, server, new(Calc)))
+
+	base = 10
+	var reply int
+	if err := client.Call("Math.Add", CalcArgs{Num1: 1, Num2: 2}, &reply); err != nil || reply != 13 {
+		t.Fatalf("Math.Add = %d, %v", reply, err)
+	}
+	if err := client.Call("Math.Neg", 5, &reply); err != nil || reply != -5 {
+		t.Fatalf("Math.Neg = %d, %v", reply, err)
+	}
+	stream, err := client.NewStream("Math.Count")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := stream.Send(i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := stream.CloseAndRecv(&reply); err != nil || reply != 3 {
+		t.Fatalf("Math.Count = %d, %v", reply, err)
+	}
+
+	// 替换服务之后统计仍然累加在同一个方法上
+	if err := server.HandleFunc("Math.Sub", func(args CalcArgs, reply *int) error {
+		*reply = args.Num1 - args.Num2
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	_ = client.Call("Math.Add", CalcArgs{}, &reply)
+	_, mtype, err := server.findService("Math.Add")
+	if err != nil || mtype.NumCalls() != 2 {
+		t.Fatalf("Math.Add NumCalls = %d, %v", mtype.NumCalls(), err)
+	}
+}
+
+func TestHandleFuncInvalid(t *testing.T) {
+	server := NewServer()
+	if err := server.Register(new(Calc)); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.HandleFunc("Math.Add", func(args int, reply *int) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		serviceMethod string
+		fn            interface{}
+		err           string
+	}{
+		{"Add", func(args int, reply *int) error { return nil }, "ill-formed"},
+		{"math.Add", func(args int, reply *int) error { return nil }, "service name"},
+		{"Math.add", func(args int, reply *int) error { return nil }, "method name"},
+		{"Math.A.B", func(args int, reply *int) error { return nil }, "method name"},
+		{"Math.Mul", 42, "not a function"},
+		{"Math.Mul", func(args int) error { return nil }, "signature"},
+		{"Math.Mul", func(args int, reply *int) {}, "signature"},
+		{"Math.Add", func(args int, reply *int) error { return nil }, "method already defined"},
+		{"Calc.Mul", func(args int, reply *int) error { return nil }, "service already defined"},
+	}
+	for _, tt := range tests {
+		err := server.HandleFunc(tt.serviceMethod, tt.fn)
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("HandleFunc(%q) err = %v, want %q", tt.serviceMethod, err, tt.err)
+		}
+	}
+	// 函数服务不能再用Register注册同名的结构体
+	type Math int
+	if err := server.Register(new(Math)); err == nil {
+		t.Fatal("Register should fail for a service registered with HandleFunc")
+	}
+}
@@ -0,0 +1,81 @@
+package geerpc
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+)
+
+const (
+	connected = "200 Connected to Gee RPC"
+	// DefaultRPCPath HandleHTTP注册的路径，DialHTTP向这个路径发送CONNECT请求
+	DefaultRPCPath = "/_geerpc_"
+)
+
+// ServeHTTP implements an http.Handler that answers RPC requests.
+// 客户端先发送CONNECT请求，连接被接管之后和普通的TCP连接一样处理
+func (server *Server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "CONNECT" {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		_, _ = io.WriteString(w, "405 must CONNECT\n")
+		return
+	}
+	conn, buf, err := w.(http.Hijacker).Hijack()
+	if err != nil {
+		server.logger.Log(LevelError, "rpc hijacking", LogKeyRemote, req.RemoteAddr, LogKeyError, err)
+		return
+	}
+	_, _ = io.WriteString(conn, "HTTP/1.0 "+connected+"\n\n")
+	if buf.Reader.Buffered() > 0 {
+		// 客户端没有等待响应就发送了option
+		conn = &hijackedConn{Conn: conn, r: buf.Reader}
+	}
+	server.ServeConn(conn)
+}
+
+// hijackedConn 先读取http服务端已经缓冲的数据
+type hijackedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *hijackedConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
+
+// HandleHTTP registers an HTTP handler for RPC messages on DefaultRPCPath.
+// It is still necessary to invoke http.Serve(), typically in a go statement.
+func (server *Server) HandleHTTP() {
+	http.Handle(DefaultRPCPath, server)
+}
+
+// HandleHTTP is a convenient approach for default server to register HTTP handlers
+func HandleHTTP() {
+	DefaultServer.HandleHTTP()
+}
+
+// NewHTTPClient new a Client instance via HTTP as transport protocol
+func NewHTTPClient(conn net.Conn, opt *Option) (*Client, error) {
+	_, _ = io.WriteString(conn, fmt.Sprintf("CONNECT %s HTTP/1.0\n\n", DefaultRPCPath))
+
+	// Require successful HTTP response
+	// before switching to RPC protocol.
+	resp, err := http.ReadResponse(bufio.NewReader(conn), &http.Request{Method: "CONNECT"})
+	if err == nil && resp.Status == connected {
+		return NewClient(conn, opt)
+	}
+	if err == nil {
+		err = errors.New("unexpected HTTP response: " + resp.Status)
+	}
+	return nil, err
+}
+
+// DialHTTP connects to an HTTP RPC server at the specified network address
+// listening on DefaultRPCPath.
+func DialHTTP(network, address string, opts ...*Option) (*Client, error) {
+	return dial(NewHTTPClient, network, address, opts...)
+}
@@ -0,0 +1,42 @@
+package geerpc
+
+import (
+	"net"
+	"net/http"
+	"testing"
+)
+
+func TestDialHTTP(t *testing.T) {
+	server := NewServer()
+	if err := server.Register(new(Calc)); err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle(DefaultRPCPath, server)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = l.Close() })
+	go func() { _ = http.Serve(l, mux) }()
+
+	client, err := DialHTTP("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	var reply int
+	if err := client.Call("Calc.Sum", CalcArgs{Num1: 1, Num2: 2}, &reply); err != nil || reply != 3 {
+		t.Fatalf("Calc.Sum = %d, %v", reply, err)
+	}
+
+	// 只接受CONNECT请求
+	resp, err := http.Get("http://" + l.Addr().String() + DefaultRPCPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Fatalf("GET status = %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,125 @@
+package geerpc
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// KeepAliveOption 客户端保活的配置
+//
+// 对方断电或者网络中断时收不到FIN，连接上的调用会一直等待下去。
+// 连接上超过Interval没有收到任何报文时，客户端调用PingMethod，
+// Timeout内没有收到响应就认为连接已经断开，关闭连接并让还在等待的调用立即失败
+type KeepAliveOption struct {
+	Interval time.Duration // 多久没有收到报文后发送ping，默认30s
+	Timeout  time.Duration // 等待ping响应的时间，默认10s
+}
+
+var DefaultKeepAliveOption = &KeepAliveOption{
+	Interval: 30 * time.Second,
+	Timeout:  10 * time.Second,
+}
+
+// ErrKeepAliveTimeout 保活的ping超时，连接已经被关闭
+// 调用可能已经被服务端执行，也可能没有
+var ErrKeepAliveTimeout error = &Error{Code: CodeUnavailable, Message: "rpc client: keepalive ping timed out"}
+
+// keepalive 定期检查连接上是否收到过报文，长时间没有收到时发送ping
+func (client *Client) keepalive(opt KeepAliveOption) {
+	if opt.Interval <= 0 {
+		opt.Interval = DefaultKeepAliveOption.Interval
+	}
+	if opt.Timeout <= 0 {
+		opt.Timeout = DefaultKeepAliveOption.Timeout
+	}
+	timer := time.NewTimer(opt.Interval)
+	defer timer.Stop()
+	for {
+		select {
+		case <-client.dead:
+			return
+		case <-timer.C:
+		}
+		idle := time.Since(time.Unix(0, atomic.LoadInt64(&client.lastRecv)))
+		if idle < opt.Interval {
+			timer.Reset(opt.Interval - idle)
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), opt.Timeout)
+		var reply uint64
+		_, err := client.invoke(ctx, PingMethod, uint64(time.Now().UnixNano()), &reply)
+		timeout := err != nil && ctx.Err() != nil
+		cancel()
+		if timeout {
+			// 其他错误说明服务端有响应，或者连接已经因为其他原因不可用
+			orNop(client.opt.Logger).Log(LevelWarn, "rpc client: keepalive timeout, closing connection",
+				LogKeyRemote, client.target)
+			client.fail(ErrKeepAliveTimeout)
+			return
+		}
+		timer.Reset(opt.Interval)
+	}
+}
+
+// fail 因为err关闭连接，还在等待的调用都以err结束
+func (client *Client) fail(err error) {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	if client.failed == nil {
+		client.failed = err
+	}
+	_ = client.cc.Close()
+}
+
+// watchIdle 连接上超过timeout没有收到报文，并且没有正在处理的调用和流时关闭连接
+// 返回的函数用于停止检查
+func (server *Server) watchIdle(sc *serverConn, timeout time.Duration) (stop func()) {
+	done := make(chan struct{})
+	go func() {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-timer.C:
+			}
+			idle := time.Since(time.Unix(0, atomic.LoadInt64(&sc.lastActive)))
+			if atomic.LoadInt32(&sc.active) > 0 {
+				timer.Reset(timeout)
+				continue
+			}
+			if idle < timeout {
+				timer.Reset(timeout - idle)
+				continue
+			}
+			server.logger.Log(LevelInfo, "rpc server: closing idle connection", LogKeyRemote, sc.peer.remote())
+			atomic.StoreInt32(&sc.idle, 1)
+			// 客户端可能正好发出了新的调用，和服务端关闭时一样，
+			// 先通知客户端不要再使用这个连接，处理完路上的请求后再关闭
+			sc.drain()
+			return
+		}
+	}()
+	return func() { close(done) }
+}
+
+// touch 记录连接上最近一次活动的时间
+func (sc *serverConn) touch() {
+	atomic.StoreInt64(&sc.lastActive, time.Now().UnixNano())
+}
+
+// busy 正在处理的调用和流的数量增加delta
+// 服务端正在关闭时，最后一个调用或流结束后开始计时，drainGrace之后关闭连接
+func (sc *serverConn) busy(delta int32) {
+	if atomic.AddInt32(&sc.active, delta) == 0 {
+		sc.closeIfDrained()
+	}
+	sc.touch()
+}
+
+// closedIdle 连接是否因为空闲被关闭
+func (sc *serverConn) closedIdle() bool {
+	return atomic.LoadInt32(&sc.idle) == 1
+}
@@ -0,0 +1,113 @@
+package geerpc
+
+import (
+	"io"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// waitDead 等待客户端的连接断开
+func waitDead(t *testing.T, client *Client, timeout time.Duration) {
+	t.Helper()
+	select {
+	case <-client.dead:
+	case <-time.After(timeout):
+		t.Fatal("connection is still open")
+	}
+}
+
+// TestKeepAlivePing 空闲的连接上客户端定期发送ping，服务端不会认为连接空闲
+func TestKeepAlivePing(t *testing.T) {
+	server := NewServer(&ServerOption{IdleTimeout: 100 * time.Millisecond})
+	addr := startServer(t, server, new(Calc))
+	client := dialTest(t, addr, &Option{KeepAlive: &KeepAliveOption{
+		Interval: 20 * time.Millisecond,
+		Timeout:  time.Second,
+	}})
+
+	time.Sleep(300 * time.Millisecond)
+	if !client.IsAvailable() {
+		t.Fatal("idle connection with keepalive pings was closed")
+	}
+	// ping的响应会更新最近收到报文的时间
+	if idle := time.Since(time.Unix(0, atomic.LoadInt64(&client.lastRecv))); idle > 100*time.Millisecond {
+		t.Fatalf("nothing received for %v, keepalive pings are not sent", idle)
+	}
+	var reply int
+	if err := client.Call("Calc.Sum", CalcArgs{Num1: 1, Num2: 2}, &reply); err != nil || reply != 3 {
+		t.Fatalf("reply = %d, %v", reply, err)
+	}
+}
+
+// TestKeepAliveTimeout 对端没有响应ping时关闭连接，等待中的调用立即失败
+func TestKeepAliveTimeout(t *testing.T) {
+	// 只读取不响应的对端，相当于对方断电后连接还留在本地
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				_, _ = io.Copy(io.Discard, conn)
+				_ = conn.Close()
+			}()
+		}
+	}()
+
+	client := dialTest(t, l.Addr().String(), &Option{KeepAlive: &KeepAliveOption{
+		Interval: 20 * time.Millisecond,
+		Timeout:  50 * time.Millisecond,
+	}})
+	var reply int
+	call := client.Go("Calc.Sum", CalcArgs{Num1: 1, Num2: 2}, &reply, nil)
+	select {
+	case <-call.Done:
+		if call.Error != ErrKeepAliveTimeout {
+			t.Fatalf("err = %v, want ErrKeepAliveTimeout", call.Error)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("call still waiting after keepalive timeout")
+	}
+	waitDead(t, client, time.Second)
+}
+
+// TestIdleTimeout 服务端关闭空闲的连接，但不会关闭还有调用在处理的连接
+func TestIdleTimeout(t *testing.T) {
+	server := NewServer(&ServerOption{IdleTimeout: 50 * time.Millisecond})
+	if err := server.HandleFunc("Slow.Sleep", func(d time.Duration, _ *int) error {
+		time.Sleep(d)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	addr := startServer(t, server)
+
+	client := dialTest(t, addr)
+	var reply int
+	if err := client.Call("Slow.Sleep", 200*time.Millisecond, &reply); err != nil {
+		t.Fatalf("call longer than IdleTimeout: %v", err)
+	}
+	waitDead(t, client, time.Second)
+	if client.IsAvailable() {
+		t.Fatal("client is still available after the server closed the idle connection")
+	}
+	if err := client.Call("Slow.Sleep", time.Duration(0), &reply); err == nil {
+		t.Fatal("expect an error on the closed connection")
+	}
+}
+
+// TestIdleTimeoutRequestInFlight 空闲连接关闭时，路上的请求仍然会被处理
+func TestIdleTimeoutRequestInFlight(t *testing.T) {
+	server := NewServer(&ServerOption{IdleTimeout: 50 * time.Millisecond})
+	_, cc := dialRaw(t, startServer(t, server, new(Calc)))
+	readGoAway(t, cc)
+	callAfterGoAway(t, cc)
+}
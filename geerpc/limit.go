@@ -0,0 +1,123 @@
+package geerpc
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// Limit 限流配置，零值表示不限制
+// 可以用在整个服务端、每个连接和每个方法上，超出限制的请求直接返回CodeResourceExhausted
+type Limit struct {
+	MaxConcurrent int     // 同时处理的请求数上限
+	Rate          float64 // 每秒允许的请求数，使用令牌桶实现
+	Burst         int     // 令牌桶的容量，默认为Rate向上取整
+}
+
+// limiter 同时限制并发数和请求速率
+type limiter struct {
+	max int
+
+	mu       sync.Mutex // protect following
+	inflight int
+	rate     float64
+	burst    float64
+	tokens   float64
+	last     time.Time
+}
+
+// newLimiter 根据配置创建限流器，不需要限制时返回nil
+func newLimiter(l Limit) *limiter {
+	if l.MaxConcurrent <= 0 && l.Rate <= 0 {
+		return nil
+	}
+	lim := &limiter{max: l.MaxConcurrent, rate: l.Rate}
+	if l.Rate > 0 {
+		lim.burst = float64(l.Burst)
+		if lim.burst <= 0 {
+			lim.burst = math.Ceil(l.Rate)
+		}
+		lim.tokens = lim.burst
+		lim.last = time.Now()
+	}
+	return lim
+}
+
+// acquire 占用一个名额，成功后必须调用release
+// nil表示不限制，总是成功
+func (l *limiter) acquire() bool {
+	if l == nil {
+		return true
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.max > 0 && l.inflight >= l.max {
+		return false
+	}
+	if l.rate > 0 {
+		now := time.Now()
+		l.tokens = math.Min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+		l.last = now
+		if l.tokens < 1 {
+			return false
+		}
+		l.tokens--
+	}
+	l.inflight++
+	return true
+}
+
+func (l *limiter) release() {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.inflight--
+}
+
+// admit 依次检查方法、连接和服务端的限制，全部通过后返回释放名额的函数
+// 内置服务不受限制，避免负载高时健康检查失败
+func (server *Server) admit(sc *serverConn, svc *service, mtype *methodType) (func(), error) {
+	if svc.builtin {
+		return func() {}, nil
+	}
+	limiters := [...]struct {
+		l     *limiter
+		scope string
+	}{
+		{mtype.limiter, "method"},
+		{sc.limiter, "connection"},
+		{server.limiter, "server"},
+	}
+	for i, lim := range limiters {
+		if !lim.l.acquire() {
+			for j := 0; j < i; j++ {
+				limiters[j].l.release()
+			}
+			return nil, Errorf(CodeResourceExhausted, "rpc server: resource exhausted: %s limit reached", lim.scope)
+		}
+	}
+	release := func() {
+		for _, lim := range limiters {
+			lim.l.release()
+		}
+	}
+	// 流的持续时间和处理延迟无关，不参与自适应降载
+	if server.shedder == nil || mtype.streaming {
+		return release, nil
+	}
+	if retryAfter, ok := server.shedder.acquire(); !ok {
+		release()
+		return nil, &Error{
+			Code:       CodeUnavailable,
+			Message:    "rpc server: overloaded, request shed",
+			RetryAfter: retryAfter,
+		}
+	}
+	start := time.Now()
+	return func() {
+		server.shedder.release(time.Since(start))
+		release()
+	}, nil
+}
@@ -0,0 +1,162 @@
+package geerpc
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"geerpc/codec"
+)
+
+// blockingServer 注册一个阻塞到release关闭的方法，每次调用开始时写入started
+func blockingServer(t *testing.T, opt *ServerOption, mopt *MethodOption) (addr string, started chan struct{}, release chan struct{}) {
+	server := NewServer(opt)
+	started, release = make(chan struct{}, 10), make(chan struct{})
+	if err := server.HandleFunc("Block.Wait", func(n int, reply *int) error {
+		started <- struct{}{}
+		<-release
+		return nil
+	}, mopt); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.HandleFunc("Block.Now", func(n int, reply *int) error { return nil }, mopt); err != nil {
+		t.Fatal(err)
+	}
+	return startServer(t, server), started, release
+}
+
+func waitStarted(t *testing.T, started chan struct{}) {
+	t.Helper()
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("call did not start")
+	}
+}
+
+func TestMethodConcurrencyLimit(t *testing.T) {
+	addr, started, release := blockingServer(t, nil, &MethodOption{Limit: Limit{MaxConcurrent: 1}})
+	client := dialTest(t, addr)
+	call := client.Go("Block.Wait", 1, new(int), nil)
+	waitStarted(t, started)
+
+	var reply int
+	if err := client.Call("Block.Wait", 1, &reply); CodeOf(err) != CodeResourceExhausted {
+		t.Fatalf("second concurrent call err = %v, want ResourceExhausted", err)
+	}
+	// 每个方法的限制是独立的
+	if err := client.Call("Block.Now", 1, &reply); err != nil {
+		t.Fatalf("other method err = %v", err)
+	}
+	// 内置的健康检查不受限制
+	var pong uint64
+	if err := client.Call(PingMethod, uint64(1), &pong); err != nil {
+		t.Fatalf("ping err = %v", err)
+	}
+	close(release)
+	if err := (<-call.Done).Error; err != nil {
+		t.Fatal(err)
+	}
+	// 名额释放后可以再次调用
+	if err := client.Call("Block.Wait", 1, &reply); err != nil {
+		t.Fatalf("call after release err = %v", err)
+	}
+}
+
+func TestMethodRateLimit(t *testing.T) {
+	server := NewServer()
+	if err := server.HandleFunc("Rate.Call", func(n int, reply *int) error { return nil },
+		&MethodOption{Limit: Limit{Rate: 20, Burst: 2}}); err != nil {
+		t.Fatal(err)
+	}
+	client := dialTest(t, startServer(t, server))
+	var reply int
+	for i := 0; i < 2; i++ {
+		if err := client.Call("Rate.Call", 1, &reply); err != nil {
+			t.Fatalf("call %d within burst err = %v", i, err)
+		}
+	}
+	err := client.Call("Rate.Call", 1, &reply)
+	if CodeOf(err) != CodeResourceExhausted {
+		t.Fatalf("call over burst err = %v, want ResourceExhausted", err)
+	}
+	// 20/s的速率，100ms后至少补充了一个令牌
+	time.Sleep(100 * time.Millisecond)
+	if err := client.Call("Rate.Call", 1, &reply); err != nil {
+		t.Fatalf("call after refill err = %v", err)
+	}
+}
+
+func TestConnLimit(t *testing.T) {
+	addr, started, release := blockingServer(t, &ServerOption{ConnLimit: Limit{MaxConcurrent: 1}}, nil)
+	defer close(release)
+	c1, c2 := dialTest(t, addr), dialTest(t, addr)
+	c1.Go("Block.Wait", 1, new(int), nil)
+	waitStarted(t, started)
+	var reply int
+	if err := c1.Call("Block.Now", 1, &reply); CodeOf(err) != CodeResourceExhausted {
+		t.Fatalf("same connection err = %v, want ResourceExhausted", err)
+	}
+	// 其他连接不受影响
+	if err := c2.Call("Block.Now", 1, &reply); err != nil {
+		t.Fatalf("other connection err = %v", err)
+	}
+}
+
+func TestLimiterTokenBucket(t *testing.T) {
+	l := newLimiter(Limit{Rate: 1})
+	if !l.acquire() {
+		t.Fatal("first acquire failed")
+	}
+	l.release()
+	// 默认容量为Rate向上取整，释放并发名额不会归还令牌
+	if l.acquire() {
+		t.Fatal("acquire succeeded without tokens")
+	}
+	l.mu.Lock()
+	l.last = l.last.Add(-time.Second)
+	l.mu.Unlock()
+	if !l.acquire() {
+		t.Fatal("acquire failed after a second of refill")
+	}
+	if newLimiter(Limit{}) != nil {
+		t.Fatal("zero Limit should not create a limiter")
+	}
+}
+
+// Repeat 返回把参数重复N次的字符串，用来构造超大的请求和响应
+type Repeat struct{}
+
+type RepeatArgs struct {
+	S string
+	N int
+}
+
+func (Repeat) Repeat(args RepeatArgs, reply *string) error {
+	*reply = strings.Repeat(args.S, args.N)
+	return nil
+}
+
+func TestMessageSizeLimit(t *testing.T) {
+	addr := startServer(t, NewServer(&ServerOption{Limits: &codec.Limits{MaxBodySize: 1024}}), Repeat{})
+	for _, ct := range []codec.Type{codec.GobType, codec.JsonType} {
+		t.Run(string(ct), func(t *testing.T) {
+			client := dialTest(t, addr, &Option{MagicNumber: MagicNumber, CodecType: ct,
+				Limits: &codec.Limits{MaxBodySize: 1024}})
+			var reply string
+			// 请求超过服务端的限制
+			err := client.Call("Repeat.Repeat", RepeatArgs{S: strings.Repeat("x", 4096), N: 1}, &reply)
+			expectCode(t, err, CodeResourceExhausted)
+			// 响应超过客户端的限制
+			err = client.Call("Repeat.Repeat", RepeatArgs{S: "x", N: 4096}, &reply)
+			expectCode(t, err, CodeResourceExhausted)
+			// 超大的报文被丢弃后，同一个连接还可以继续调用
+			if err := client.Call("Repeat.Repeat", RepeatArgs{S: "ab", N: 2}, &reply); err != nil || reply != "abab" {
+				t.Fatalf("call after too large: %v %q", err, reply)
+			}
+			if !client.IsAvailable() {
+				t.Fatal("client closed after too large message")
+			}
+		})
+	}
+}
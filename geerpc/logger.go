@@ -0,0 +1,92 @@
+package geerpc
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+// LogLevel 日志级别
+type LogLevel int
+
+const (
+	LevelDebug LogLevel = iota - 1
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+func (l LogLevel) String() string {
+	switch l {
+	case LevelDebug:
+		return "DEBUG"
+	case LevelInfo:
+		return "INFO"
+	case LevelWarn:
+		return "WARN"
+	case LevelError:
+		return "ERROR"
+	}
+	return fmt.Sprintf("LEVEL(%d)", int(l))
+}
+
+// Logger 结构化的日志接口
+// 服务端通过ServerOption.Logger配置，客户端通过Option.Logger配置，默认不输出任何日志。
+// kv是成对出现的key和value，例如"method", "Foo.Sum", "seq", 1
+type Logger interface {
+	Log(level LogLevel, msg string, kv ...interface{})
+}
+
+// 日志中常用的key
+const (
+	LogKeyMethod = "method"
+	LogKeySeq    = "seq"
+	LogKeyRemote = "remote"
+	LogKeyCodec  = "codec"
+	LogKeyError  = "error"
+)
+
+type nopLogger struct{}
+
+func (nopLogger) Log(LogLevel, string, ...interface{}) {}
+
+// orNop nil时返回不输出日志的Logger
+func orNop(l Logger) Logger {
+	if l == nil {
+		return nopLogger{}
+	}
+	return l
+}
+
+// stdLogger 使用标准库log输出
+type stdLogger struct {
+	l   *log.Logger
+	min LogLevel
+}
+
+// NewStdLogger 使用标准库的*log.Logger输出级别不低于min的日志，l为nil时使用log的默认Logger
+// 输出的格式为：LEVEL msg key=value ...
+func NewStdLogger(l *log.Logger, min LogLevel) Logger {
+	if l == nil {
+		l = log.Default()
+	}
+	return &stdLogger{l: l, min: min}
+}
+
+func (s *stdLogger) Log(level LogLevel, msg string, kv ...interface{}) {
+	if level < s.min {
+		return
+	}
+	var b strings.Builder
+	b.WriteString(level.String())
+	b.WriteByte(' ')
+	b.WriteString(msg)
+	for i := 0; i < len(kv); i += 2 {
+		if i+1 < len(kv) {
+			fmt.Fprintf(&b, " %v=%v", kv[i], kv[i+1])
+		} else {
+			fmt.Fprintf(&b, " %v", kv[i])
+		}
+	}
+	_ = s.l.Output(2, b.String())
+}
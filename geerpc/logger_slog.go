@@ -0,0 +1,27 @@
+//go:build go1.21
+// +build go1.21
+
+package geerpc
+
+import (
+	"context"
+	"log/slog"
+)
+
+// slogLogger 把日志交给log/slog
+type slogLogger struct {
+	l *slog.Logger
+}
+
+// NewSlogLogger 使用log/slog输出日志，l为nil时使用slog.Default()
+// 日志级别按照slog的级别一一对应，kv直接作为slog的属性
+func NewSlogLogger(l *slog.Logger) Logger {
+	if l == nil {
+		l = slog.Default()
+	}
+	return &slogLogger{l: l}
+}
+
+func (s *slogLogger) Log(level LogLevel, msg string, kv ...interface{}) {
+	s.l.Log(context.Background(), slog.Level(level*4), msg, kv...)
+}
@@ -0,0 +1,37 @@
+//go:build go1.21
+// +build go1.21
+
+package geerpc
+
+import (
+	"bytes"
+	"log/slog"
+	"testing"
+)
+
+func TestSlogLogger(t *testing.T) {
+	var buf bytes.Buffer
+	h := slog.NewTextHandler(&buf, &slog.HandlerOptions{
+		Level: slog.LevelDebug,
+		ReplaceAttr: func(_ []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return a
+		},
+	})
+	l := NewSlogLogger(slog.New(h))
+	for _, level := range []LogLevel{LevelDebug, LevelInfo, LevelWarn, LevelError} {
+		l.Log(level, "msg", LogKeyMethod, "Calc.Sum", LogKeySeq, 1)
+	}
+	want := "level=DEBUG msg=msg method=Calc.Sum seq=1\n" +
+		"level=INFO msg=msg method=Calc.Sum seq=1\n" +
+		"level=WARN msg=msg method=Calc.Sum seq=1\n" +
+		"level=ERROR msg=msg method=Calc.Sum seq=1\n"
+	if buf.String() != want {
+		t.Fatalf("output = %q, want %q", buf.String(), want)
+	}
+	if NewSlogLogger(nil) == nil {
+		t.Fatal("NewSlogLogger(nil) returned nil")
+	}
+}
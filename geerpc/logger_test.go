@@ -0,0 +1,69 @@
+package geerpc
+
+import (
+	"bytes"
+	"log"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestStdLogger(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewStdLogger(log.New(&buf, "", 0), LevelInfo)
+	l.Log(LevelDebug, "hidden", LogKeySeq, 1)
+	l.Log(LevelWarn, "rpc server: slow call", LogKeyMethod, "Calc.Sum", LogKeySeq, 7, "odd")
+	want := "WARN rpc server: slow call method=Calc.Sum seq=7 odd\n"
+	if buf.String() != want {
+		t.Fatalf("output = %q, want %q", buf.String(), want)
+	}
+	if s := LogLevel(5).String(); s != "LEVEL(5)" {
+		t.Fatalf("LogLevel(5) = %q", s)
+	}
+	orNop(nil).Log(LevelError, "dropped")
+}
+
+// recordLogger 记录所有日志，用来检查服务端输出的日志
+type recordLogger struct {
+	mu   sync.Mutex
+	logs []string
+}
+
+func (r *recordLogger) Log(level LogLevel, msg string, kv ...interface{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var b strings.Builder
+	l := NewStdLogger(log.New(&b, "", 0), LevelDebug)
+	l.Log(level, msg, kv...)
+	r.logs = append(r.logs, strings.TrimSuffix(b.String(), "\n"))
+}
+
+func (r *recordLogger) find(prefix string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, s := range r.logs {
+		if strings.HasPrefix(s, prefix) {
+			return s
+		}
+	}
+	return ""
+}
+
+func TestServerLogger(t *testing.T) {
+	logger := new(recordLogger)
+	server := NewServer(&ServerOption{Logger: logger})
+	if err := server.HandleFunc("Panic.Call", func(_ int, _ *int) error { panic("boom") }); err != nil {
+		t.Fatal(err)
+	}
+	client := dialTest(t, startServer(t, server))
+	var reply int
+	_ = client.Call("Panic.Call", 0, &reply)
+
+	if s := logger.find("DEBUG rpc server: register"); !strings.Contains(s, "method=Panic.Call") {
+		t.Fatalf("register log = %q", s)
+	}
+	s := logger.find("ERROR")
+	if !strings.Contains(s, "method=Panic.Call") || !strings.Contains(s, "error=boom") {
+		t.Fatalf("panic log = %q", s)
+	}
+}
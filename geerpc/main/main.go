@@ -1,16 +1,43 @@
 package main
 
 import (
-	"encoding/json"
-	"fmt"
 	"geerpc"
-	"geerpc/codec"
+	"io"
 	"log"
 	"net"
-	"time"
+	"sync"
 )
 
+type Foo int
+
+type Args struct{ Num1, Num2 int }
+
+func (f Foo) Sum(args Args, reply *int) error {
+	*reply = args.Num1 + args.Num2
+	return nil
+}
+
+// SumAll 客户端流：客户端发送多个数字，服务端最后返回它们的和
+func (f Foo) SumAll(stream *geerpc.ServerStream) error {
+	var sum int
+	for {
+		var num int
+		err := stream.Recv(&num)
+		if err == io.EOF {
+			return stream.Send(sum)
+		}
+		if err != nil {
+			return err
+		}
+		sum += num
+	}
+}
+
 func startServer(addr chan string) {
+	var foo Foo
+	if err := geerpc.Register(&foo); err != nil {
+		log.Fatal("register error:", err)
+	}
 	// pick a free port
 	l, err := net.Listen("tcp", ":0")
 	if err != nil {
@@ -22,31 +49,45 @@ func startServer(addr chan string) {
 }
 
 func main() {
+	log.SetFlags(0)
 	// 创建一个channel，并开启协程启动server
-	//
 	addr := make(chan string)
 	go startServer(addr)
 
-	// in fact, following code is like a simple geerpc client
-	conn, _ := net.Dial("tcp", <-addr)
-	defer func() { _ = conn.Close() }()
+	client, err := geerpc.Dial("tcp", <-addr)
+	if err != nil {
+		log.Fatal("dial error:", err)
+	}
+	defer func() { _ = client.Close() }()
 
-	time.Sleep(time.Second)
-	// send options
-	_ = json.NewEncoder(conn).Encode(geerpc.DefaultOption)
-	cc := codec.NewGobCodec(conn)
 	// send request & receive response
-	// 这里虽然是通过协程并发执行，但实际上是一个个顺序发送的
-	// 因为encoder将内容写入connection时使用了互斥锁
+	var wg sync.WaitGroup
 	for i := 0; i < 5; i++ {
-		h := &codec.Header{
-			ServiceMethod: "Foo.Sum",
-			Seq:           uint64(i),
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			args := &Args{Num1: i, Num2: i * i}
+			var reply int
+			if err := client.Call("Foo.Sum", args, &reply); err != nil {
+				log.Fatal("call Foo.Sum error:", err)
+			}
+			log.Printf("%d + %d = %d", args.Num1, args.Num2, reply)
+		}(i)
+	}
+	wg.Wait()
+
+	stream, err := client.NewStream("Foo.SumAll")
+	if err != nil {
+		log.Fatal("open stream error:", err)
+	}
+	for i := 1; i <= 100; i++ {
+		if err := stream.Send(i); err != nil {
+			log.Fatal("send error:", err)
 		}
-		_ = cc.Write(h, fmt.Sprintf("geerpc req %d", h.Seq))
-		_ = cc.ReadHeader(h)
-		var reply string
-		_ = cc.ReadBody(&reply)
-		log.Println("reply:", reply)
 	}
+	var sum int
+	if err := stream.CloseAndRecv(&sum); err != nil {
+		log.Fatal("stream Foo.SumAll error:", err)
+	}
+	log.Println("sum of 1..100 =", sum)
 }
@@ -0,0 +1,79 @@
+package geerpc
+
+import (
+	"geerpc/codec"
+	"io"
+	"time"
+)
+
+// Metrics 收集服务端和客户端的指标
+// 服务端通过ServerOption.Metrics配置，客户端通过Option.Metrics配置，
+// 实现需要是并发安全的，也不能阻塞。PrometheusMetrics是内置的实现
+type Metrics interface {
+	// ServerStart 服务端开始处理一个请求或者流
+	// 找不到服务方法时serviceMethod为"unknown"，防止指标的数量无限增长
+	ServerStart(serviceMethod string)
+	// ServerDone 服务端处理完一个请求或者流，latency从读取到请求头开始计算
+	ServerDone(serviceMethod string, code Code, latency time.Duration)
+	// ServerBytes 服务端的一个连接上读取和写入的字节数
+	ServerBytes(codecType codec.Type, in, out int)
+
+	// ClientStart 客户端向target发起一次调用或者打开一个流
+	ClientStart(target, serviceMethod string)
+	// ClientDone 客户端的一次调用或者流结束
+	ClientDone(target, serviceMethod string, code Code, latency time.Duration)
+	// ClientBytes 客户端到target的连接上读取和写入的字节数
+	ClientBytes(target string, codecType codec.Type, in, out int)
+}
+
+// unknownMethod 找不到的服务方法在指标中统一使用这个名字
+const unknownMethod = "unknown"
+
+// observeServer 记录服务端开始处理，返回结束时调用的函数
+func observeServer(m Metrics, serviceMethod string, found bool) func(err error) {
+	if m == nil {
+		return func(error) {}
+	}
+	if !found {
+		serviceMethod = unknownMethod
+	}
+	start := time.Now()
+	m.ServerStart(serviceMethod)
+	return func(err error) {
+		m.ServerDone(serviceMethod, CodeOf(err), time.Since(start))
+	}
+}
+
+// observeClient 记录客户端开始调用，返回结束时调用的函数
+func observeClient(m Metrics, target, serviceMethod string) func(err error) {
+	if m == nil {
+		return nil
+	}
+	start := time.Now()
+	m.ClientStart(target, serviceMethod)
+	return func(err error) {
+		m.ClientDone(target, serviceMethod, CodeOf(err), time.Since(start))
+	}
+}
+
+// countingConn 统计连接上读取和写入的字节数
+type countingConn struct {
+	io.ReadWriteCloser
+	report func(in, out int)
+}
+
+func (c *countingConn) Read(p []byte) (int, error) {
+	n, err := c.ReadWriteCloser.Read(p)
+	if n > 0 {
+		c.report(n, 0)
+	}
+	return n, err
+}
+
+func (c *countingConn) Write(p []byte) (int, error) {
+	n, err := c.ReadWriteCloser.Write(p)
+	if n > 0 {
+		c.report(0, n)
+	}
+	return n, err
+}
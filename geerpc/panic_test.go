@@ -0,0 +1,71 @@
+package geerpc
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+func newPanicServer(t *testing.T, opt *ServerOption) *Server {
+	t.Helper()
+	server := NewServer(opt)
+	if err := server.HandleFunc("Panic.Call", func(_ int, _ *int) error { panic("boom") }); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.HandleFunc("Panic.Stream", func(stream *ServerStream) error { panic("boom") }); err != nil {
+		t.Fatal(err)
+	}
+	return server
+}
+
+// TestHandlerPanic 服务方法panic只影响这一次调用，连接还可以继续使用
+func TestHandlerPanic(t *testing.T) {
+	server := newPanicServer(t, nil)
+	client := dialTest(t, startServer(t, server, new(Calc)))
+
+	var reply int
+	for i := 1; i <= 3; i++ {
+		err := client.Call("Panic.Call", 0, &reply)
+		if CodeOf(err) != CodeInternal || !strings.Contains(err.Error(), "boom") {
+			t.Fatalf("err = %v, want CodeInternal with the panic value", err)
+		}
+		if strings.Contains(err.Error(), "goroutine") {
+			t.Fatalf("stack should not be sent without Debug: %v", err)
+		}
+		if err := client.Call("Calc.Sum", CalcArgs{Num1: i, Num2: 1}, &reply); err != nil || reply != i+1 {
+			t.Fatalf("reply = %d, %v after panic", reply, err)
+		}
+	}
+
+	cs, err := client.NewStream("Panic.Stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cs.Recv(&reply); err == io.EOF || CodeOf(err) != CodeInternal {
+		t.Fatalf("stream err = %v, want CodeInternal", err)
+	}
+	if err := client.Call("Calc.Sum", CalcArgs{Num1: 1, Num2: 1}, &reply); err != nil || reply != 2 {
+		t.Fatalf("reply = %d, %v after stream panic", reply, err)
+	}
+
+	if n := server.NumPanics(); n != 4 {
+		t.Fatalf("server.NumPanics() = %d, want 4", n)
+	}
+	_, m, err := server.findService("Panic.Call")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := m.NumPanics(); n != 3 {
+		t.Fatalf("method NumPanics() = %d, want 3", n)
+	}
+}
+
+// TestHandlerPanicDebug Debug模式下错误中带有panic时的调用栈
+func TestHandlerPanicDebug(t *testing.T) {
+	client := dialTest(t, startServer(t, newPanicServer(t, &ServerOption{Debug: true})))
+	var reply int
+	err := client.Call("Panic.Call", 0, &reply)
+	if CodeOf(err) != CodeInternal || !strings.Contains(err.Error(), "goroutine") {
+		t.Fatalf("err = %v, want the stack in Debug mode", err)
+	}
+}
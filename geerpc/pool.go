@@ -0,0 +1,381 @@
+package geerpc
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// PoolOption 连接池的配置
+type PoolOption struct {
+	Size         int           // 每个地址维持的连接数，默认4
+	PingInterval time.Duration // 健康检查的间隔，默认10s，小于0时不做健康检查
+	PingTimeout  time.Duration // 健康检查的超时时间，默认1s
+
+	// 每个地址一个熔断器，nil表示不熔断
+	Breaker *BreakerOption
+}
+
+var DefaultPoolOption = &PoolOption{
+	Size:         4,
+	PingInterval: 10 * time.Second,
+	PingTimeout:  time.Second,
+}
+
+// ErrNoAvailableConn 所有地址都连接不上
+var ErrNoAvailableConn error = &Error{Code: CodeUnavailable, Message: "rpc pool: no available connection"}
+
+// Pool 对每个地址维持多个连接
+// 同一个Client上的请求都由一个写协程依次发送，多个连接可以提高吞吐量
+// 每次调用选择负载最低（等待响应的调用最少）的连接，
+// 不可用的连接会被替换，并定期通过PingMethod检测半开的TCP连接
+type Pool struct {
+	network string
+	addrs   []string
+	opt     *Option
+	popt    *PoolOption
+
+	breakers map[string]*breaker
+	// 每个地址连续重新连接的次数，用于退避，连接上的调用成功后清零
+	attempts map[string]*int32
+
+	mu     sync.Mutex           // protect following
+	conns  map[string][]*Client // 每个地址Size个位置，nil表示需要重新连接
+	closed bool
+	done   chan struct{}
+	next   uint32 // 没有可用连接时，轮流选择一个地址建立连接
+}
+
+// NewPool 创建一个连接池，连接在第一次使用时建立
+func NewPool(network string, addrs []string, popt *PoolOption, opts ...*Option) (*Pool, error) {
+	if len(addrs) == 0 {
+		return nil, errors.New("rpc pool: no address")
+	}
+	opt, err := parseOptions(opts...)
+	if err != nil {
+		return nil, err
+	}
+	if popt == nil {
+		popt = DefaultPoolOption
+	}
+	o := *popt
+	popt = &o
+	if popt.Size <= 0 {
+		popt.Size = DefaultPoolOption.Size
+	}
+	if popt.PingTimeout <= 0 {
+		popt.PingTimeout = DefaultPoolOption.PingTimeout
+	}
+	p := &Pool{
+		network:  network,
+		addrs:    addrs,
+		opt:      opt,
+		popt:     popt,
+		conns:    make(map[string][]*Client, len(addrs)),
+		attempts: make(map[string]*int32, len(addrs)),
+		done:     make(chan struct{}),
+	}
+	for _, addr := range addrs {
+		p.conns[addr] = make([]*Client, popt.Size)
+		p.attempts[addr] = new(int32)
+	}
+	if popt.Breaker != nil {
+		p.breakers = make(map[string]*breaker, len(addrs))
+		for _, addr := range addrs {
+			p.breakers[addr] = newBreaker(addr, popt.Breaker)
+		}
+	}
+	if popt.PingInterval == 0 {
+		popt.PingInterval = DefaultPoolOption.PingInterval
+	}
+	go p.fill()
+	if popt.PingInterval > 0 {
+		go p.healthCheck()
+	}
+	return p, nil
+}
+
+// get 返回负载最低的可用连接，没有可用连接时新建一个
+// 处于熔断状态的地址会被跳过
+func (p *Pool) get() (*Client, string, error) {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil, "", ErrClientClosed
+	}
+	var best *Client
+	var bestAddr string
+	bestLoad := -1
+	var ready []string
+	for _, addr := range p.addrs {
+		if b := p.breakers[addr]; b != nil && !b.ready() {
+			continue
+		}
+		ready = append(ready, addr)
+		for _, client := range p.conns[addr] {
+			if client == nil || !client.IsAvailable() {
+				continue
+			}
+			if load := client.numPending(); bestLoad < 0 || load < bestLoad {
+				best, bestAddr, bestLoad = client, addr, load
+			}
+		}
+	}
+	p.mu.Unlock()
+	if best != nil {
+		return best, bestAddr, nil
+	}
+	if len(ready) == 0 {
+		return nil, "", ErrCircuitOpen
+	}
+
+	// 依次尝试每个地址
+	start := atomic.AddUint32(&p.next, 1)
+	for i := range ready {
+		addr := ready[(int(start)+i)%len(ready)]
+		if client, err := p.dial(addr); err == nil {
+			return client, addr, nil
+		} else if b := p.breakers[addr]; b != nil && err != ErrClientClosed {
+			// 连接不上也算作一次失败
+			if generation, ok := b.allow(); ok {
+				b.done(generation, &Error{Code: CodeUnavailable, Message: err.Error()})
+			}
+		}
+	}
+	return nil, "", ErrNoAvailableConn
+}
+
+// dial 新建一个到addr的连接，放到第一个空位上
+func (p *Pool) dial(addr string) (*Client, error) {
+	client, err := Dial(p.network, addr, p.opt)
+	if err != nil {
+		return nil, err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		_ = client.Close()
+		return nil, ErrClientClosed
+	}
+	slots := p.conns[addr]
+	for i, c := range slots {
+		if c == nil || !c.IsAvailable() {
+			slots[i] = client
+			go p.watch(addr, client)
+			return client, nil
+		}
+	}
+	// 已经被其他协程填满了，这些连接都是可用的
+	_ = client.Close()
+	return slots[0], nil
+}
+
+// fill 补满每个地址的连接数，处于熔断状态的地址会被跳过
+func (p *Pool) fill() {
+	for _, addr := range p.addrs {
+		if b := p.breakers[addr]; b != nil && !b.ready() {
+			continue
+		}
+		p.mu.Lock()
+		var missing int
+		for _, client := range p.conns[addr] {
+			if client == nil || !client.IsAvailable() {
+				missing++
+			}
+		}
+		p.mu.Unlock()
+		for i := 0; i < missing; i++ {
+			if _, err := p.dial(addr); err != nil {
+				break
+			}
+		}
+	}
+}
+
+// watch 连接不可用或者服务端即将关闭时，立即从池中移除并补上新的连接
+// 即将关闭的连接会在已经发出的调用结束后自己断开
+func (p *Pool) watch(addr string, client *Client) {
+	select {
+	case <-p.done:
+		return
+	case <-client.dead:
+	case <-client.goingAway:
+	}
+	p.remove(addr, client)
+	p.redial(addr)
+}
+
+// redial 补上addr的一个连接
+// 每次重新连接都会增加退避的次数，直到这个地址上有调用成功才清零，
+// 服务端每次都拒绝握手时不会一直重连。处于熔断状态时不重新连接，之后由get或者健康检查补上
+func (p *Pool) redial(addr string) {
+	for {
+		if b := p.breakers[addr]; b != nil && !b.ready() {
+			return
+		}
+		if attempt := atomic.AddInt32(p.attempts[addr], 1) - 1; attempt > 0 {
+			ropt := DefaultReconnectOption
+			timer := time.NewTimer(backoff(ropt.MinBackoff, ropt.MaxBackoff, ropt.Jitter, int(attempt-1)))
+			select {
+			case <-p.done:
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+		}
+		if _, err := p.dial(addr); err == nil || err == ErrClientClosed {
+			return
+		}
+	}
+}
+
+func (p *Pool) remove(addr string, client *Client) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for i, c := range p.conns[addr] {
+		if c == client {
+			p.conns[addr][i] = nil
+		}
+	}
+}
+
+// healthCheck 定期ping每一个连接，替换掉不可用的连接并补满连接数
+func (p *Pool) healthCheck() {
+	ticker := time.NewTicker(p.popt.PingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-ticker.C:
+		}
+		p.checkOnce()
+	}
+}
+
+// checkOnce ping每一个连接，关闭半开的连接，然后补满连接数
+// 服务端即将关闭的连接只从池中移除，不能关闭，它会在已经发出的调用结束后自己断开
+func (p *Pool) checkOnce() {
+	for _, addr := range p.addrs {
+		p.mu.Lock()
+		slots := append([]*Client(nil), p.conns[addr]...)
+		p.mu.Unlock()
+		for _, client := range slots {
+			if client == nil {
+				continue
+			}
+			if client.isDraining() {
+				p.remove(addr, client)
+				continue
+			}
+			if err := p.ping(client); err != nil {
+				p.remove(addr, client)
+				if !client.isDraining() {
+					// 半开的连接读不到任何数据，只能主动关闭
+					_ = client.Close()
+				}
+			}
+		}
+	}
+	p.fill()
+}
+
+func (p *Pool) ping(client *Client) error {
+	ctx, cancel := context.WithTimeout(context.Background(), p.popt.PingTimeout)
+	defer cancel()
+	var reply uint64
+	return client.CallContext(ctx, PingMethod, uint64(time.Now().UnixNano()), &reply)
+}
+
+// Call invokes the named function, waits for it to complete,
+// and returns its error status.
+func (p *Pool) Call(serviceMethod string, args, reply interface{}) error {
+	return p.CallContext(context.Background(), serviceMethod, args, reply)
+}
+
+// CallContext 在负载最低的连接上发起一次调用
+// 请求还没有发出时（例如连接正好断开，或者服务端即将关闭），换一个连接重新发送；
+// 配置了Option.Retry时由重试策略处理，每次重试都会重新选择连接
+func (p *Pool) CallContext(ctx context.Context, serviceMethod string, args, reply interface{}) error {
+	if p.opt.Retry != nil {
+		return p.opt.Retry.do(ctx, serviceMethod, func() (bool, bool, error) {
+			client, sent, err := p.invoke(ctx, serviceMethod, args, reply)
+			return sent, client != nil && client.isIdempotent(serviceMethod), err
+		})
+	}
+	// 每次失败的连接都不再可用，最多把池中的每个位置都尝试一遍
+	for i := 0; ; i++ {
+		client, sent, err := p.invoke(ctx, serviceMethod, args, reply)
+		if err == nil || sent || client == nil || ctx.Err() != nil || i >= len(p.addrs)*p.popt.Size {
+			return err
+		}
+	}
+}
+
+// invoke 选择一个连接发起一次调用，返回使用的连接，没有可用的连接时为nil
+func (p *Pool) invoke(ctx context.Context, serviceMethod string, args, reply interface{}) (*Client, bool, error) {
+	client, addr, err := p.get()
+	if err != nil {
+		return nil, false, err
+	}
+	b := p.breakers[addr]
+	var generation uint64
+	if b != nil {
+		var ok bool
+		if generation, ok = b.allow(); !ok {
+			return nil, false, ErrCircuitOpen
+		}
+	}
+	sent, err := client.invoke(ctx, serviceMethod, args, reply)
+	if a := p.attempts[addr]; err == nil && atomic.LoadInt32(a) != 0 {
+		atomic.StoreInt32(a, 0)
+	}
+	if b != nil {
+		if drained(client, err) {
+			b.ignore(generation)
+		} else {
+			b.done(generation, err)
+		}
+	}
+	return client, sent, err
+}
+
+// drained 调用失败是因为服务端正在关闭这个连接，不能说明这个地址不健康
+// 服务端返回的错误都是*Error，连接断开导致的错误不是
+func drained(client *Client, err error) bool {
+	if errors.Is(err, ErrGoingAway) {
+		return true
+	}
+	var e *Error
+	return err != nil && client.isDraining() && !errors.As(err, &e) && CodeOf(err) == CodeUnavailable
+}
+
+// BreakerState 返回addr的熔断器状态，没有配置熔断器时总是BreakerClosed
+func (p *Pool) BreakerState(addr string) BreakerState {
+	if b := p.breakers[addr]; b != nil {
+		return b.current()
+	}
+	return BreakerClosed
+}
+
+// Close 关闭连接池中的所有连接
+func (p *Pool) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return ErrClientClosed
+	}
+	p.closed = true
+	close(p.done)
+	for _, slots := range p.conns {
+		for i, client := range slots {
+			if client != nil {
+				_ = client.Close()
+				slots[i] = nil
+			}
+		}
+	}
+	return nil
+}
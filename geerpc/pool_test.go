@@ -0,0 +1,260 @@
+package geerpc
+
+import (
+	"io"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestPoolHealthCheckDraining 健康检查不能关闭服务端即将关闭的连接，上面的调用要能正常结束
+func TestPoolHealthCheckDraining(t *testing.T) {
+	server := NewServer()
+	started, release := make(chan struct{}), make(chan struct{})
+	if err := server.HandleFunc("Slow.Wait", func(n int, reply *int) error {
+		close(started)
+		<-release
+		*reply = n
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	addr := startServer(t, server)
+	p, err := NewPool("tcp", []string{addr}, &PoolOption{Size: 1, PingInterval: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	errc := make(chan error, 1)
+	go func() {
+		var reply int
+		errc <- p.Call("Slow.Wait", 1, &reply)
+	}()
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("call did not start")
+	}
+	p.mu.Lock()
+	client := p.conns[addr][0]
+	p.mu.Unlock()
+	// 收到FrameGoAway之后，watch还没来得及移除这个连接
+	client.mu.Lock()
+	client.draining = true
+	client.mu.Unlock()
+
+	p.checkOnce()
+	p.mu.Lock()
+	replaced := p.conns[addr][0] != client
+	p.mu.Unlock()
+	if !replaced {
+		t.Fatal("draining client is still in the pool")
+	}
+	close(release)
+	select {
+	case err := <-errc:
+		if err != nil {
+			t.Fatalf("in-flight call on draining client failed: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("in-flight call did not finish")
+	}
+}
+
+// TestPoolDrainedErrors 服务端关闭连接导致的失败不计入熔断，服务端返回的错误照常计入
+func TestPoolDrainedErrors(t *testing.T) {
+	client := dialTest(t, startServer(t, NewServer(), new(Calc)))
+	if !drained(client, ErrGoingAway) {
+		t.Fatal("ErrGoingAway should not count as a failure")
+	}
+	if drained(client, io.EOF) {
+		t.Fatal("connection loss without FrameGoAway should count as a failure")
+	}
+	client.mu.Lock()
+	client.draining = true
+	client.mu.Unlock()
+	if !drained(client, ErrShutdown) || !drained(client, io.EOF) {
+		t.Fatal("connection loss after FrameGoAway should not count as a failure")
+	}
+	if drained(client, Errorf(CodeUnavailable, "overloaded")) {
+		t.Fatal("errors returned by the server should count as failures")
+	}
+}
+
+// poolSlots 返回addr上每个位置的连接
+func poolSlots(p *Pool, addr string) []*Client {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]*Client(nil), p.conns[addr]...)
+}
+
+// waitFilled 等待addr上的每个位置都是可用的连接
+func waitFilled(t *testing.T, p *Pool, addr string) []*Client {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		slots := poolSlots(p, addr)
+		filled := true
+		for _, client := range slots {
+			if client == nil || !client.IsAvailable() {
+				filled = false
+			}
+		}
+		if filled {
+			return slots
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("pool is not filled: %v", slots)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// countingListener 统计接受的连接数
+type countingListener struct {
+	net.Listener
+	accepted int32
+}
+
+func (l *countingListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err == nil {
+		atomic.AddInt32(&l.accepted, 1)
+	}
+	return conn, err
+}
+
+func TestPoolLeastLoaded(t *testing.T) {
+	addr, started, release := blockingServer(t, nil, nil)
+	defer close(release)
+	p, err := NewPool("tcp", []string{addr}, &PoolOption{Size: 2, PingInterval: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	slots := waitFilled(t, p, addr)
+
+	var reply int
+	slots[0].Go("Block.Wait", 1, &reply, nil)
+	waitStarted(t, started)
+	for i := 0; i < 3; i++ {
+		if client, _, err := p.get(); err != nil || client != slots[1] {
+			t.Fatalf("get() = %p, %v, want the idle client %p", client, err, slots[1])
+		}
+	}
+}
+
+func TestPoolReplaceUnavailable(t *testing.T) {
+	addr := startServer(t, NewServer(), new(Calc))
+	p, err := NewPool("tcp", []string{addr}, &PoolOption{Size: 1, PingInterval: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	old := waitFilled(t, p, addr)[0]
+	_ = old.Close()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if slots := waitFilled(t, p, addr); slots[0] != old {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("closed client was not replaced")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	var reply int
+	if err := p.Call("Calc.Sum", CalcArgs{Num1: 1, Num2: 2}, &reply); err != nil || reply != 3 {
+		t.Fatalf("reply = %d, %v", reply, err)
+	}
+}
+
+func TestPoolRefillAfterRedial(t *testing.T) {
+	server := NewServer()
+	addr := startServer(t, server, new(Calc))
+	p, err := NewPool("tcp", []string{addr}, &PoolOption{Size: 2, PingInterval: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	waitFilled(t, p, addr)
+
+	// 服务端重启期间重新连接会失败，按照退避的间隔重试
+	stopServer(server)
+	time.Sleep(200 * time.Millisecond)
+	if n := atomic.LoadInt32(p.attempts[addr]); n < 2 {
+		t.Fatalf("attempts = %d, expect redials to fail while the server is down", n)
+	}
+	restarted := NewServer()
+	if err := restarted.Register(new(Calc)); err != nil {
+		t.Fatal(err)
+	}
+	serveOn(t, addr, restarted)
+	waitFilled(t, p, addr)
+
+	var reply int
+	if err := p.Call("Calc.Sum", CalcArgs{Num1: 1, Num2: 2}, &reply); err != nil || reply != 3 {
+		t.Fatalf("reply = %d, %v", reply, err)
+	}
+	// 调用成功后退避的次数清零
+	if n := atomic.LoadInt32(p.attempts[addr]); n != 0 {
+		t.Fatalf("attempts = %d after a successful call, want 0", n)
+	}
+}
+
+// TestPoolRedialBackoff 服务端每次都拒绝握手时，重新连接要退避，不能一直重连
+func TestPoolRedialBackoff(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cl := &countingListener{Listener: l}
+	defer cl.Close()
+	go newAuthServer(t, TokenAuth{"token": {Identity: "alice"}}).Accept(cl)
+
+	p, err := NewPool("tcp", []string{l.Addr().String()}, &PoolOption{Size: 1, PingInterval: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	time.Sleep(500 * time.Millisecond)
+	if n := atomic.LoadInt32(&cl.accepted); n == 0 || n > 10 {
+		t.Fatalf("accepted %d connections in 500ms, expect a few redials with backoff", n)
+	}
+}
+
+// TestPoolCheckOnceHalfOpen 对端不再响应的连接ping超时，健康检查关闭它并补上新的连接
+func TestPoolCheckOnceHalfOpen(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	// 只接受连接，从不读取和响应，和半开的TCP连接一样
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			t.Cleanup(func() { _ = conn.Close() })
+		}
+	}()
+	addr := l.Addr().String()
+	p, err := NewPool("tcp", []string{addr}, &PoolOption{Size: 1, PingInterval: -1, PingTimeout: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	old := waitFilled(t, p, addr)[0]
+
+	p.checkOnce()
+	if old.IsAvailable() {
+		t.Fatal("half-open client is still open after checkOnce")
+	}
+	if slots := poolSlots(p, addr); slots[0] == old || slots[0] == nil {
+		t.Fatal("half-open client was not replaced")
+	}
+}
@@ -0,0 +1,228 @@
+package geerpc
+
+import (
+	"bytes"
+	"fmt"
+	"geerpc/codec"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultBuckets 延迟直方图默认的分桶，单位秒
+var DefaultBuckets = []float64{.001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// PrometheusMetrics 内置的Metrics实现，同时是一个http.Handler，
+// 以Prometheus的文本格式输出所有指标，例如：
+//
+//	m := geerpc.NewPrometheusMetrics()
+//	server := geerpc.NewServer(&geerpc.ServerOption{Metrics: m})
+//	http.Handle("/metrics", m)
+type PrometheusMetrics struct {
+	buckets []float64
+
+	mu       sync.Mutex // protect following
+	families map[string]*family
+}
+
+var _ Metrics = (*PrometheusMetrics)(nil)
+
+// NewPrometheusMetrics 创建PrometheusMetrics，buckets为空时使用DefaultBuckets
+func NewPrometheusMetrics(buckets ...float64) *PrometheusMetrics {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	b := append([]float64(nil), buckets...)
+	sort.Float64s(b)
+	return &PrometheusMetrics{buckets: b, families: make(map[string]*family)}
+}
+
+const (
+	kindCounter   = "counter"
+	kindGauge     = "gauge"
+	kindHistogram = "histogram"
+)
+
+// family 同名的一组指标，按标签的取值区分
+type family struct {
+	name, help, kind string
+	labels           []string
+	series           map[string]*series
+}
+
+type series struct {
+	values []string // 标签的取值，和family.labels一一对应
+	value  float64  // counter和gauge的值，histogram的总和
+	count  uint64   // histogram的样本数
+	counts []uint64 // histogram每个分桶的样本数，不累加
+}
+
+// with 找到标签取值对应的指标，不存在时创建，调用时必须持有m.mu
+func (m *PrometheusMetrics) with(name, help, kind string, labels []string, values ...string) *series {
+	f := m.families[name]
+	if f == nil {
+		f = &family{name: name, help: help, kind: kind, labels: labels, series: make(map[string]*series)}
+		m.families[name] = f
+	}
+	key := strings.Join(values, "\x00")
+	s := f.series[key]
+	if s == nil {
+		s = &series{values: values}
+		if kind == kindHistogram {
+			s.counts = make([]uint64, len(m.buckets))
+		}
+		f.series[key] = s
+	}
+	return s
+}
+
+func (m *PrometheusMetrics) observe(s *series, d time.Duration) {
+	v := d.Seconds()
+	s.value += v
+	s.count++
+	for i, b := range m.buckets {
+		if v <= b {
+			s.counts[i]++
+			break
+		}
+	}
+}
+
+var (
+	serverMethodLabels = []string{"method"}
+	serverCodeLabels   = []string{"method", "code"}
+	serverCodecLabels  = []string{"codec"}
+	clientMethodLabels = []string{"target", "method"}
+	clientCodeLabels   = []string{"target", "method", "code"}
+	clientCodecLabels  = []string{"target", "codec"}
+)
+
+func (m *PrometheusMetrics) ServerStart(serviceMethod string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.with("geerpc_server_in_flight", "Number of requests and streams being handled by the server.",
+		kindGauge, serverMethodLabels, serviceMethod).value++
+}
+
+func (m *PrometheusMetrics) ServerDone(serviceMethod string, code Code, latency time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.with("geerpc_server_in_flight", "Number of requests and streams being handled by the server.",
+		kindGauge, serverMethodLabels, serviceMethod).value--
+	m.with("geerpc_server_handled_total", "Total number of requests and streams handled by the server.",
+		kindCounter, serverCodeLabels, serviceMethod, code.String()).value++
+	m.observe(m.with("geerpc_server_handling_seconds", "Latency of requests and streams handled by the server.",
+		kindHistogram, serverMethodLabels, serviceMethod), latency)
+}
+
+func (m *PrometheusMetrics) ServerBytes(codecType codec.Type, in, out int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if in > 0 {
+		m.with("geerpc_server_received_bytes_total", "Total bytes read by the server.",
+			kindCounter, serverCodecLabels, string(codecType)).value += float64(in)
+	}
+	if out > 0 {
+		m.with("geerpc_server_sent_bytes_total", "Total bytes written by the server.",
+			kindCounter, serverCodecLabels, string(codecType)).value += float64(out)
+	}
+}
+
+func (m *PrometheusMetrics) ClientStart(target, serviceMethod string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.with("geerpc_client_in_flight", "Number of calls and streams started by the client and not finished.",
+		kindGauge, clientMethodLabels, target, serviceMethod).value++
+}
+
+func (m *PrometheusMetrics) ClientDone(target, serviceMethod string, code Code, latency time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.with("geerpc_client_in_flight", "Number of calls and streams started by the client and not finished.",
+		kindGauge, clientMethodLabels, target, serviceMethod).value--
+	m.with("geerpc_client_handled_total", "Total number of calls and streams finished by the client.",
+		kindCounter, clientCodeLabels, target, serviceMethod, code.String()).value++
+	m.observe(m.with("geerpc_client_handling_seconds", "Latency of calls and streams seen by the client.",
+		kindHistogram, clientMethodLabels, target, serviceMethod), latency)
+}
+
+func (m *PrometheusMetrics) ClientBytes(target string, codecType codec.Type, in, out int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if in > 0 {
+		m.with("geerpc_client_received_bytes_total", "Total bytes read by the client.",
+			kindCounter, clientCodecLabels, target, string(codecType)).value += float64(in)
+	}
+	if out > 0 {
+		m.with("geerpc_client_sent_bytes_total", "Total bytes written by the client.",
+			kindCounter, clientCodecLabels, target, string(codecType)).value += float64(out)
+	}
+}
+
+// ServeHTTP 以Prometheus的文本格式输出所有指标
+// 持有锁时只在内存中生成内容，抓取方读得再慢也不会阻塞调用中记录指标
+func (m *PrometheusMetrics) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	var buf bytes.Buffer
+	m.mu.Lock()
+	names := make([]string, 0, len(m.families))
+	for name := range m.families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		m.writeFamily(&buf, m.families[name])
+	}
+	m.mu.Unlock()
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_, _ = buf.WriteTo(w)
+}
+
+func (m *PrometheusMetrics) writeFamily(w *bytes.Buffer, f *family) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", f.name, f.help, f.name, f.kind)
+	keys := make([]string, 0, len(f.series))
+	for key := range f.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		s := f.series[key]
+		labels := formatLabels(f.labels, s.values)
+		if f.kind != kindHistogram {
+			fmt.Fprintf(w, "%s%s %s\n", f.name, wrapLabels(labels), formatFloat(s.value))
+			continue
+		}
+		var cumulative uint64
+		for i, b := range m.buckets {
+			cumulative += s.counts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", f.name, wrapLabels(labels, `le="`+formatFloat(b)+`"`), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", f.name, wrapLabels(labels, `le="+Inf"`), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", f.name, wrapLabels(labels), formatFloat(s.value))
+		fmt.Fprintf(w, "%s_count%s %d\n", f.name, wrapLabels(labels), s.count)
+	}
+}
+
+func formatLabels(names, values []string) []string {
+	labels := make([]string, len(names))
+	for i, name := range names {
+		labels[i] = name + `="` + labelEscaper.Replace(values[i]) + `"`
+	}
+	return labels
+}
+
+func wrapLabels(labels []string, extra ...string) string {
+	all := append(append([]string(nil), labels...), extra...)
+	if len(all) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(all, ",") + "}"
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
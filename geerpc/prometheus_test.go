@@ -0,0 +1,117 @@
+package geerpc
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// scrape 像Prometheus一样通过HTTP抓取指标
+func scrape(t *testing.T, url string) string {
+	t.Helper()
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Fatalf("Content-Type = %q", ct)
+	}
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestPrometheusScrape(t *testing.T) {
+	m := NewPrometheusMetrics(0.5, 1)
+	addr := startServer(t, NewServer(&ServerOption{Metrics: m}), new(Calc))
+	client := dialTest(t, addr, &Option{Metrics: m})
+	var reply int
+	if err := client.Call("Calc.Sum", CalcArgs{Num1: 1, Num2: 2}, &reply); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Call("Calc.Missing", CalcArgs{}, &reply); CodeOf(err) != CodeNotFound {
+		t.Fatalf("err = %v, want CodeNotFound", err)
+	}
+	hs := httptest.NewServer(m)
+	defer hs.Close()
+
+	labels := `target="` + addr + `",method="Calc.Sum"`
+	want := []string{
+		"# TYPE geerpc_server_handled_total counter",
+		`geerpc_server_handled_total{method="Calc.Sum",code="OK"} 1`,
+		`geerpc_server_handled_total{method="unknown",code="NotFound"} 1`,
+		`geerpc_server_in_flight{method="Calc.Sum"} 0`,
+		"# TYPE geerpc_server_handling_seconds histogram",
+		`geerpc_server_handling_seconds_bucket{method="Calc.Sum",le="0.5"} 1`,
+		`geerpc_server_handling_seconds_bucket{method="Calc.Sum",le="+Inf"} 1`,
+		`geerpc_server_handling_seconds_count{method="Calc.Sum"} 1`,
+		`geerpc_server_handling_seconds_sum{method="Calc.Sum"} `,
+		"# TYPE geerpc_client_handled_total counter",
+		`geerpc_client_handled_total{` + labels + `,code="OK"} 1`,
+		"# TYPE geerpc_client_handling_seconds histogram",
+		`geerpc_client_handling_seconds_count{` + labels + `} 1`,
+		`geerpc_server_received_bytes_total{codec="application/gob"} `,
+		`geerpc_client_sent_bytes_total{target="` + addr + `",codec="application/gob"} `,
+	}
+	// 服务端在发送响应之后才记录指标，客户端收到响应时可能还没有记录
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		text := scrape(t, hs.URL)
+		var missing []string
+		for _, line := range want {
+			if !strings.Contains(text, line) {
+				missing = append(missing, line)
+			}
+		}
+		if len(missing) == 0 {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("missing %q in\n%s", missing, text)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// blockingWriter 模拟读得很慢的抓取方，Write一直阻塞到release被关闭
+type blockingWriter struct {
+	header  http.Header
+	writing chan struct{}
+	release chan struct{}
+}
+
+func (w *blockingWriter) Header() http.Header { return w.header }
+func (w *blockingWriter) WriteHeader(int)     {}
+func (w *blockingWriter) Write(p []byte) (int, error) {
+	close(w.writing)
+	<-w.release
+	return len(p), nil
+}
+
+// TestPrometheusSlowScrape 抓取方阻塞时，记录指标不会被阻塞
+func TestPrometheusSlowScrape(t *testing.T) {
+	m := NewPrometheusMetrics()
+	m.ServerStart("Calc.Sum")
+	w := &blockingWriter{header: make(http.Header), writing: make(chan struct{}), release: make(chan struct{})}
+	defer close(w.release)
+	go m.ServeHTTP(w, nil)
+	<-w.writing
+
+	done := make(chan struct{})
+	go func() {
+		m.ServerDone("Calc.Sum", CodeOK, time.Millisecond)
+		m.ClientStart("127.0.0.1:1", "Calc.Sum")
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("metrics hooks blocked by a slow scraper")
+	}
+}
@@ -0,0 +1,316 @@
+package geerpc
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// ConnState 可重连客户端的连接状态
+type ConnState int
+
+const (
+	StateConnecting   ConnState = iota // 正在建立连接
+	StateReady                         // 连接可用
+	StateReconnecting                  // 连接断开，正在等待重连
+	StateClosed                        // 用户已经关闭了客户端
+)
+
+func (s ConnState) String() string {
+	switch s {
+	case StateConnecting:
+		return "connecting"
+	case StateReady:
+		return "ready"
+	case StateReconnecting:
+		return "reconnecting"
+	case StateClosed:
+		return "closed"
+	}
+	return "unknown"
+}
+
+// ReconnectOption 可重连客户端的配置
+type ReconnectOption struct {
+	MinBackoff time.Duration // 第一次重连前的等待时间，默认100ms
+	MaxBackoff time.Duration // 每次失败后等待时间翻倍，这是上限，默认10s
+	Jitter     float64       // 等待时间随机浮动的比例，取值0~1，默认0.2
+
+	// 连接断开导致失败的调用，如果方法是幂等的，重连后重新发送
+	// 方法被Idempotent或者服务端注册时标记为幂等都可以
+	// 还没有发出去的调用总是会在重连后发送
+	RetryIdempotent bool
+	Idempotent      func(serviceMethod string) bool
+
+	// 连接状态变化时调用，不能阻塞
+	// 调用是串行的，顺序和状态变化的顺序一致，在回调中调用Close也是安全的
+	OnStateChange func(ConnState)
+}
+
+var DefaultReconnectOption = &ReconnectOption{
+	MinBackoff: 100 * time.Millisecond,
+	MaxBackoff: 10 * time.Second,
+	Jitter:     0.2,
+}
+
+// ReconnectClient 连接断开后会自动重连的客户端
+// 重连时使用指数退避加随机抖动，并重新发送option完成握手
+type ReconnectClient struct {
+	network, address string
+	opt              *Option
+	ropt             *ReconnectOption
+
+	mu     sync.Mutex // protect following
+	client *Client    // 当前的连接，重连期间为nil
+	ready  chan struct{}
+	state  ConnState
+	closed chan struct{}
+	// 等待通知OnStateChange的状态，由正在通知的协程按顺序发出
+	notifyQueue []ConnState
+	notifying   bool
+}
+
+// ErrClientClosed 用户已经关闭了可重连客户端
+var ErrClientClosed = errors.New("rpc client: client is closed")
+
+// DialReconnect 连接到指定地址的服务端，之后连接断开时在后台自动重连
+// 第一次连接失败时直接返回错误
+func DialReconnect(network, address string, ropt *ReconnectOption, opts ...*Option) (*ReconnectClient, error) {
+	opt, err := parseOptions(opts...)
+	if err != nil {
+		return nil, err
+	}
+	if ropt == nil {
+		ropt = DefaultReconnectOption
+	}
+	rc := &ReconnectClient{
+		network: network,
+		address: address,
+		opt:     opt,
+		ropt:    ropt,
+		ready:   make(chan struct{}),
+		closed:  make(chan struct{}),
+		// StateConnecting是零值，先设置为无效的状态，第一次连接也会通知
+		state: -1,
+	}
+	rc.setState(StateConnecting)
+	client, err := Dial(network, address, opt)
+	if err != nil {
+		return nil, err
+	}
+	rc.connected(client)
+	return rc, nil
+}
+
+// connected 切换到新的连接并开始监控它
+func (rc *ReconnectClient) connected(client *Client) {
+	rc.mu.Lock()
+	select {
+	case <-rc.closed:
+		rc.mu.Unlock()
+		_ = client.Close()
+		return
+	default:
+	}
+	rc.client = client
+	close(rc.ready)
+	rc.mu.Unlock()
+	rc.setState(StateReady)
+	go rc.watch(client)
+}
+
+// drop 连接不可用，等待下一个连接
+func (rc *ReconnectClient) drop(client *Client) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if rc.client == client {
+		rc.client = nil
+		rc.ready = make(chan struct{})
+	}
+}
+
+// watch 等待连接不可用，然后在后台重连
+// 服务端即将关闭时旧连接会把已经发出的调用处理完，新的调用使用新的连接
+func (rc *ReconnectClient) watch(client *Client) {
+	var goingAway bool
+	select {
+	case <-rc.closed:
+		return
+	case <-client.dead:
+	case <-client.goingAway:
+		goingAway = true
+	}
+
+	rc.drop(client)
+	rc.setState(StateReconnecting)
+
+	for attempt := 0; ; attempt++ {
+		// 服务端主动下线时不需要退避，立即建立新的连接
+		if attempt > 0 || !goingAway {
+			select {
+			case <-rc.closed:
+				return
+			case <-time.After(rc.backoff(attempt)):
+			}
+		}
+		rc.setState(StateConnecting)
+		client, err := Dial(rc.network, rc.address, rc.opt)
+		if err == nil {
+			rc.connected(client)
+			return
+		}
+		rc.setState(StateReconnecting)
+	}
+}
+
+// backoff 第attempt次重连前需要等待的时间
+func (rc *ReconnectClient) backoff(attempt int) time.Duration {
+	return backoff(rc.ropt.MinBackoff, rc.ropt.MaxBackoff, rc.ropt.Jitter, attempt)
+}
+
+// backoff 指数退避：每次翻倍直到max，再上下随机浮动jitter的比例
+func backoff(min, max time.Duration, jitter float64, attempt int) time.Duration {
+	if min <= 0 {
+		min = DefaultReconnectOption.MinBackoff
+	}
+	if max < min {
+		max = min
+	}
+	d := min
+	for i := 0; i < attempt && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	if jitter > 0 {
+		d = time.Duration(float64(d) * (1 + jitter*(2*rand.Float64()-1)))
+	}
+	return d
+}
+
+// setState 切换状态并通知OnStateChange
+// 回调在锁外执行，同时只有一个协程在通知，其他协程的状态变化排队，
+// 这样回调收到的顺序和状态变化的顺序一致
+func (rc *ReconnectClient) setState(state ConnState) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if rc.state == state || rc.state == StateClosed {
+		return
+	}
+	rc.state = state
+	if rc.ropt.OnStateChange == nil {
+		return
+	}
+	rc.notifyQueue = append(rc.notifyQueue, state)
+	if rc.notifying {
+		// 正在通知的协程会接着通知这次变化
+		return
+	}
+	rc.notifying = true
+	for len(rc.notifyQueue) > 0 {
+		s := rc.notifyQueue[0]
+		rc.notifyQueue = rc.notifyQueue[1:]
+		rc.mu.Unlock()
+		rc.ropt.OnStateChange(s)
+		rc.mu.Lock()
+	}
+	rc.notifying = false
+}
+
+// State 返回当前的连接状态
+func (rc *ReconnectClient) State() ConnState {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return rc.state
+}
+
+// getClient 返回当前可用的连接，重连期间等待连接恢复
+func (rc *ReconnectClient) getClient(ctx context.Context) (*Client, error) {
+	for {
+		rc.mu.Lock()
+		client, ready := rc.client, rc.ready
+		rc.mu.Unlock()
+		if client != nil {
+			if client.IsAvailable() {
+				return client, nil
+			}
+			// 连接刚刚断开，watch可能还没来得及切换
+			rc.drop(client)
+			continue
+		}
+		select {
+		case <-rc.closed:
+			return nil, ErrClientClosed
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-ready:
+		}
+	}
+}
+
+// Call invokes the named function, waits for it to complete,
+// and returns its error status.
+func (rc *ReconnectClient) Call(serviceMethod string, args, reply interface{}) error {
+	return rc.CallContext(context.Background(), serviceMethod, args, reply)
+}
+
+// CallContext 发起一次调用，连接断开时等待重连
+// 调用因为连接断开而失败时，还没发送的调用和幂等的调用会在重连后重新发送
+// 配置了Option.Retry时，其他可重试的错误按照重试策略处理
+func (rc *ReconnectClient) CallContext(ctx context.Context, serviceMethod string, args, reply interface{}) error {
+	if rc.opt.Retry == nil {
+		_, _, err := rc.invoke(ctx, serviceMethod, args, reply)
+		return err
+	}
+	return rc.opt.Retry.do(ctx, serviceMethod, func() (bool, bool, error) {
+		return rc.invoke(ctx, serviceMethod, args, reply)
+	})
+}
+
+// invoke 发起一次调用，连接断开时按照ReconnectOption决定是否在新连接上重新发送
+func (rc *ReconnectClient) invoke(ctx context.Context, serviceMethod string, args, reply interface{}) (bool, bool, error) {
+	for {
+		client, err := rc.getClient(ctx)
+		if err != nil {
+			return false, false, err
+		}
+		sent, err := client.invoke(ctx, serviceMethod, args, reply)
+		idempotent := client.isIdempotent(serviceMethod)
+		// 只有连接断开才在新连接上重新发送，例如认证失败时重新发送也没有用
+		if err == nil || client.IsAvailable() || ctx.Err() != nil || CodeOf(err) != CodeUnavailable {
+			return sent, idempotent, err
+		}
+		// 连接已经断开，判断能不能重新发送
+		if sent && !(rc.ropt.RetryIdempotent && (idempotent || rc.idempotent(serviceMethod))) {
+			return sent, idempotent, err
+		}
+	}
+}
+
+// idempotent 客户端是否认为这个方法是幂等的
+func (rc *ReconnectClient) idempotent(serviceMethod string) bool {
+	return rc.ropt.Idempotent != nil && rc.ropt.Idempotent(serviceMethod)
+}
+
+// Close 关闭客户端，不再重连
+func (rc *ReconnectClient) Close() error {
+	rc.mu.Lock()
+	select {
+	case <-rc.closed:
+		rc.mu.Unlock()
+		return ErrClientClosed
+	default:
+	}
+	close(rc.closed)
+	client := rc.client
+	rc.client = nil
+	rc.mu.Unlock()
+	rc.setState(StateClosed)
+	if client != nil {
+		return client.Close()
+	}
+	return nil
+}
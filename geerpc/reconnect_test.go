@@ -0,0 +1,229 @@
+package geerpc
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// stateRecorder 记录OnStateChange收到的状态
+type stateRecorder struct {
+	mu     sync.Mutex
+	states []ConnState
+	ch     chan ConnState
+}
+
+func newStateRecorder() *stateRecorder {
+	return &stateRecorder{ch: make(chan ConnState, 100)}
+}
+
+func (r *stateRecorder) record(s ConnState) {
+	r.mu.Lock()
+	r.states = append(r.states, s)
+	r.mu.Unlock()
+	r.ch <- s
+}
+
+func (r *stateRecorder) get() []ConnState {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]ConnState(nil), r.states...)
+}
+
+// wait 等待收到状态s
+func (r *stateRecorder) wait(t *testing.T, s ConnState) {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case got := <-r.ch:
+			if got == s {
+				return
+			}
+		case <-timeout:
+			t.Fatalf("timeout waiting for state %s, got %v", s, r.get())
+		}
+	}
+}
+
+// stopServer 立即关闭服务端和它的所有连接
+func stopServer(server *Server) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_ = server.Shutdown(ctx)
+}
+
+func serveOn(t *testing.T, addr string, server *Server) {
+	t.Helper()
+	var l net.Listener
+	var err error
+	// 刚关闭的端口可能还不能马上监听
+	for i := 0; i < 50; i++ {
+		if l, err = net.Listen("tcp", addr); err == nil {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = l.Close() })
+	go server.Accept(l)
+}
+
+func TestReconnectAfterRestart(t *testing.T) {
+	server := NewServer()
+	if err := server.Register(new(Calc)); err != nil {
+		t.Fatal(err)
+	}
+	addr := startServer(t, server)
+	rec := newStateRecorder()
+	rc, err := DialReconnect("tcp", addr, &ReconnectOption{
+		MinBackoff:    10 * time.Millisecond,
+		MaxBackoff:    50 * time.Millisecond,
+		OnStateChange: rec.record,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	var reply int
+	if err := rc.Call("Calc.Sum", CalcArgs{Num1: 1, Num2: 2}, &reply); err != nil || reply != 3 {
+		t.Fatalf("Calc.Sum = %d, %v", reply, err)
+	}
+
+	// 服务端重启期间的调用等待重连
+	stopServer(server)
+	rec.wait(t, StateReconnecting)
+	time.Sleep(100 * time.Millisecond) // 让客户端至少失败一次
+	restarted := NewServer()
+	if err := restarted.Register(new(Calc)); err != nil {
+		t.Fatal(err)
+	}
+	serveOn(t, addr, restarted)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := rc.CallContext(ctx, "Calc.Sum", CalcArgs{Num1: 3, Num2: 4}, &reply); err != nil || reply != 7 {
+		t.Fatalf("Calc.Sum after restart = %d, %v", reply, err)
+	}
+	if rc.State() != StateReady {
+		t.Fatalf("state = %s, want ready", rc.State())
+	}
+
+	// 状态按照变化的顺序通知，相邻的状态不会重复
+	states := rec.get()
+	if len(states) < 5 || states[0] != StateConnecting || states[1] != StateReady || states[len(states)-1] != StateReady {
+		t.Fatalf("states = %v", states)
+	}
+	for i := 1; i < len(states); i++ {
+		prev, cur := states[i-1], states[i]
+		if prev == cur || (cur == StateReady && prev != StateConnecting) {
+			t.Fatalf("invalid transition %s -> %s in %v", prev, cur, states)
+		}
+	}
+}
+
+func TestReconnectCloseDuringRedial(t *testing.T) {
+	server := NewServer()
+	addr := startServer(t, server)
+	rec := newStateRecorder()
+	rc, err := DialReconnect("tcp", addr, &ReconnectOption{
+		MinBackoff:    10 * time.Millisecond,
+		MaxBackoff:    20 * time.Millisecond,
+		OnStateChange: rec.record,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stopServer(server)
+	// 服务端不再启动，客户端一直在重连
+	rec.wait(t, StateReconnecting)
+	rec.wait(t, StateConnecting)
+
+	// 等待重连的调用在Close后返回
+	errc := make(chan error, 1)
+	go func() {
+		var reply int
+		errc <- rc.Call("Calc.Sum", CalcArgs{}, &reply)
+	}()
+	time.Sleep(20 * time.Millisecond)
+	if err := rc.Close(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-errc:
+		if err != ErrClientClosed {
+			t.Fatalf("Call err = %v, want ErrClientClosed", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Call did not return after Close")
+	}
+	rec.wait(t, StateClosed)
+	// 关闭之后不再有任何状态变化
+	time.Sleep(100 * time.Millisecond)
+	if states := rec.get(); states[len(states)-1] != StateClosed {
+		t.Fatalf("states after close = %v", states)
+	}
+	if err := rc.Close(); err != ErrClientClosed {
+		t.Fatalf("second Close err = %v", err)
+	}
+}
+
+func TestReconnectStateChangeCallsClose(t *testing.T) {
+	server := NewServer()
+	addr := startServer(t, server)
+	var rc *ReconnectClient
+	ready := make(chan struct{})
+	closed := make(chan struct{})
+	rec := newStateRecorder()
+	rc, err := DialReconnect("tcp", addr, &ReconnectOption{
+		MinBackoff: 10 * time.Millisecond,
+		OnStateChange: func(s ConnState) {
+			rec.record(s)
+			if s == StateReconnecting {
+				// 在回调中关闭客户端不会死锁，StateClosed在这次回调返回后通知
+				<-ready
+				_ = rc.Close()
+				close(closed)
+			}
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	close(ready)
+	stopServer(server)
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close in OnStateChange blocked")
+	}
+	rec.wait(t, StateClosed)
+	want := []ConnState{StateConnecting, StateReady, StateReconnecting, StateClosed}
+	if got := rec.get(); len(got) != len(want) || got[2] != StateReconnecting || got[3] != StateClosed {
+		t.Fatalf("states = %v, want %v", got, want)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	min, max := 10*time.Millisecond, 80*time.Millisecond
+	want := []time.Duration{10, 20, 40, 80, 80, 80}
+	for attempt, w := range want {
+		if got := backoff(min, max, 0, attempt); got != w*time.Millisecond {
+			t.Errorf("backoff(%d) = %v, want %v", attempt, got, w*time.Millisecond)
+		}
+	}
+	// 抖动在上下jitter的比例之内
+	for i := 0; i < 100; i++ {
+		d := backoff(min, max, 0.5, 2)
+		if d < 20*time.Millisecond || d > 60*time.Millisecond {
+			t.Fatalf("backoff with jitter = %v, want within [20ms, 60ms]", d)
+		}
+	}
+	// 没有配置时使用默认值
+	if got := backoff(0, 0, 0, 0); got != DefaultReconnectOption.MinBackoff {
+		t.Errorf("backoff with zero option = %v", got)
+	}
+}
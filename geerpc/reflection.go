@@ -0,0 +1,143 @@
+package geerpc
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// ReflectionService 服务端内置的反射服务，客户端可以通过它发现服务端注册的服务和方法，
+// 不需要事先知道参数的类型就能构造请求，ServerOption.DisableReflection可以关闭
+//
+//	_Reflection.List     参数是服务名，空字符串表示所有服务；返回[]ServiceInfo，只包含方法名
+//	_Reflection.Describe 参数是"Service"或者"Service.Method"；返回ServiceInfo，包含参数和响应的类型
+const ReflectionService = "_Reflection"
+
+// ServiceInfo 描述一个服务
+type ServiceInfo struct {
+	Name    string
+	Methods []MethodInfo `json:",omitempty"`
+}
+
+// MethodInfo 描述服务的一个方法
+type MethodInfo struct {
+	Name       string
+	Stream     bool      `json:",omitempty"` // 流方法，消息的类型由方法自己决定
+	Idempotent bool      `json:",omitempty"`
+	ArgType    *TypeInfo `json:",omitempty"`
+	ReplyType  *TypeInfo `json:",omitempty"`
+}
+
+// TypeInfo 根据reflect描述一个类型的结构
+type TypeInfo struct {
+	Name   string      // 类型的名字，例如main.Args、*int、[]string
+	Kind   string      // reflect.Kind，例如struct、ptr、slice
+	Elem   *TypeInfo   `json:",omitempty"` // 指针、切片、数组和map的元素类型
+	Len    int         `json:",omitempty"` // 数组的长度
+	Key    *TypeInfo   `json:",omitempty"` // map的key的类型
+	Fields []FieldInfo `json:",omitempty"` // 结构体导出的字段
+}
+
+// FieldInfo 描述结构体的一个字段
+type FieldInfo struct {
+	Name string
+	Tag  string `json:",omitempty"`
+	Type *TypeInfo
+}
+
+// reflection 反射服务的实现，注册名为ReflectionService
+type reflection struct {
+	server *Server
+}
+
+// List 列出服务和方法名，按名字排序
+func (r *reflection) List(name string, reply *[]ServiceInfo) error {
+	var infos []ServiceInfo
+	r.server.serviceMap.Range(func(_, v interface{}) bool {
+		s := v.(*service)
+		if name == "" || s.name == name {
+			infos = append(infos, describeService(s, "", false))
+		}
+		return true
+	})
+	if name != "" && len(infos) == 0 {
+		return Errorf(CodeNotFound, "rpc server: can't find service %s", name)
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	*reply = infos
+	return nil
+}
+
+// Describe 描述一个服务或者服务的一个方法，包括参数和响应的类型
+func (r *reflection) Describe(name string, reply *ServiceInfo) error {
+	serviceName, methodName := name, ""
+	if dot := strings.LastIndex(name, "."); dot >= 0 {
+		serviceName, methodName = name[:dot], name[dot+1:]
+	}
+	v, ok := r.server.serviceMap.Load(serviceName)
+	if !ok {
+		return Errorf(CodeNotFound, "rpc server: can't find service %s", serviceName)
+	}
+	s := v.(*service)
+	if methodName != "" && s.method[methodName] == nil {
+		return Errorf(CodeNotFound, "rpc server: can't find method %s", methodName)
+	}
+	*reply = describeService(s, methodName, true)
+	return nil
+}
+
+// describeService 描述服务s，method不为空时只描述这一个方法，withTypes表示是否描述参数和响应的类型
+func describeService(s *service, method string, withTypes bool) ServiceInfo {
+	info := ServiceInfo{Name: s.name}
+	for name, m := range s.method {
+		if method != "" && name != method {
+			continue
+		}
+		mi := MethodInfo{Name: name, Stream: m.streaming, Idempotent: m.idempotent}
+		if withTypes && !m.streaming {
+			mi.ArgType = describeType(m.ArgType, nil)
+			mi.ReplyType = describeType(m.ReplyType, nil)
+		}
+		info.Methods = append(info.Methods, mi)
+	}
+	sort.Slice(info.Methods, func(i, j int) bool { return info.Methods[i].Name < info.Methods[j].Name })
+	return info
+}
+
+// describeType 描述类型t，seen是外层正在描述的结构体
+// 递归引用自己的结构体在内层只给出名字和Kind
+func describeType(t reflect.Type, seen map[reflect.Type]bool) *TypeInfo {
+	info := &TypeInfo{Name: t.String(), Kind: t.Kind().String()}
+	switch t.Kind() {
+	case reflect.Array:
+		info.Len = t.Len()
+		info.Elem = describeType(t.Elem(), seen)
+	case reflect.Ptr, reflect.Slice:
+		info.Elem = describeType(t.Elem(), seen)
+	case reflect.Map:
+		info.Key = describeType(t.Key(), seen)
+		info.Elem = describeType(t.Elem(), seen)
+	case reflect.Struct:
+		if seen[t] {
+			return info
+		}
+		if seen == nil {
+			seen = make(map[reflect.Type]bool)
+		}
+		seen[t] = true
+		defer delete(seen, t)
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if f.PkgPath != "" {
+				// 没有导出的字段不会被编码
+				continue
+			}
+			info.Fields = append(info.Fields, FieldInfo{
+				Name: f.Name,
+				Tag:  string(f.Tag),
+				Type: describeType(f.Type, seen),
+			})
+		}
+	}
+	return info
+}
@@ -0,0 +1,84 @@
+package geerpc
+
+import (
+	"geerpc/codec"
+	"reflect"
+	"testing"
+)
+
+// Node 递归引用自己的类型
+type Node struct {
+	Value    int `json:"value"`
+	Children []*Node
+	hidden   int
+}
+
+func (c *Calc) Walk(root Node, reply *map[string]int) error {
+	return nil
+}
+
+func TestReflection(t *testing.T) {
+	server := NewServer()
+	if err := server.HandleFunc("Math.Neg", func(n int, reply *int) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	addr := startServer(t, server, new(Calc))
+	for _, ct := range []codec.Type{codec.GobType, codec.JsonType} {
+		client := dialTest(t, addr, &Option{MagicNumber: MagicNumber, CodecType: ct})
+
+		var services []ServiceInfo
+		if err := client.Call(ReflectionService+".List", "", &services); err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, s := range services {
+			names = append(names, s.Name)
+		}
+		if want := []string{"Calc", "Math", "_Reflection", "_rpc"}; !reflect.DeepEqual(names, want) {
+			t.Fatalf("%s: services = %v, want %v", ct, names, want)
+		}
+		if err := client.Call(ReflectionService+".List", "Calc", &services); err != nil {
+			t.Fatal(err)
+		}
+		want := []MethodInfo{{Name: "Double", Stream: true}, {Name: "Sum"}, {Name: "SumAll", Stream: true}, {Name: "Walk"}}
+		if len(services) != 1 || !reflect.DeepEqual(services[0].Methods, want) {
+			t.Fatalf("%s: Calc = %+v", ct, services)
+		}
+
+		var info ServiceInfo
+		if err := client.Call(ReflectionService+".Describe", "Calc.Walk", &info); err != nil {
+			t.Fatal(err)
+		}
+		intType := &TypeInfo{Name: "int", Kind: "int"}
+		node := &TypeInfo{Name: "geerpc.Node", Kind: "struct"}
+		wantWalk := MethodInfo{
+			Name: "Walk",
+			ArgType: &TypeInfo{Name: "geerpc.Node", Kind: "struct", Fields: []FieldInfo{
+				{Name: "Value", Tag: `json:"value"`, Type: intType},
+				{Name: "Children", Type: &TypeInfo{Name: "[]*geerpc.Node", Kind: "slice",
+					Elem: &TypeInfo{Name: "*geerpc.Node", Kind: "ptr", Elem: node}}},
+			}},
+			ReplyType: &TypeInfo{Name: "*map[string]int", Kind: "ptr",
+				Elem: &TypeInfo{Name: "map[string]int", Kind: "map", Key: &TypeInfo{Name: "string", Kind: "string"}, Elem: intType}},
+		}
+		if len(info.Methods) != 1 || !reflect.DeepEqual(info.Methods[0], wantWalk) {
+			t.Fatalf("%s: Describe(Calc.Walk) = %+v", ct, info)
+		}
+
+		if err := client.Call(ReflectionService+".Describe", "Math", &info); err != nil {
+			t.Fatal(err)
+		}
+		if len(info.Methods) != 1 || info.Methods[0].ArgType.Kind != "int" {
+			t.Fatalf("%s: Describe(Math) = %+v", ct, info)
+		}
+		if err := client.Call(ReflectionService+".Describe", "Calc.Missing", &info); CodeOf(err) != CodeNotFound {
+			t.Fatalf("%s: Describe(Calc.Missing) err = %v", ct, err)
+		}
+	}
+
+	client := dialTest(t, startServer(t, NewServer(&ServerOption{DisableReflection: true})))
+	var services []ServiceInfo
+	if err := client.Call(ReflectionService+".List", "", &services); CodeOf(err) != CodeNotFound {
+		t.Fatalf("reflection disabled: err = %v", err)
+	}
+}
@@ -0,0 +1,131 @@
+package geerpc
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// RetryPolicy 调用失败时的重试策略
+//
+// 请求还没写入连接就失败时，可以放心地重试；
+// 请求已经发出后，只有幂等的方法才会重试，因为服务端可能已经执行过一次。
+// 方法可以在客户端通过Idempotent标记为幂等，也可以在服务端注册时通过MethodOption标记
+type RetryPolicy struct {
+	MaxAttempts    int           // 最多调用几次，包括第一次，默认3
+	InitialBackoff time.Duration // 第一次重试前的等待时间，默认50ms
+	MaxBackoff     time.Duration // 每次重试后等待时间翻倍，这是上限，默认1s
+	Jitter         float64       // 等待时间随机浮动的比例，取值0~1
+
+	// 可以重试的错误码，默认只有CodeUnavailable
+	RetryableCodes []Code
+	// 客户端认为幂等的方法
+	Idempotent func(serviceMethod string) bool
+	// 重试预算，用来限制重试占调用的比例，避免后端出问题时重试风暴把它彻底压垮
+	Budget *RetryBudget
+}
+
+func (p *RetryPolicy) maxAttempts() int {
+	if p.MaxAttempts <= 0 {
+		return 3
+	}
+	return p.MaxAttempts
+}
+
+func (p *RetryPolicy) backoff(retry int) time.Duration {
+	min, max := p.InitialBackoff, p.MaxBackoff
+	if min <= 0 {
+		min = 50 * time.Millisecond
+	}
+	if max <= 0 {
+		max = time.Second
+	}
+	return backoff(min, max, p.Jitter, retry)
+}
+
+func (p *RetryPolicy) retryable(err error) bool {
+	code := CodeOf(err)
+	if len(p.RetryableCodes) == 0 {
+		return code == CodeUnavailable
+	}
+	for _, c := range p.RetryableCodes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+// do 按照重试策略执行attempt
+// attempt返回请求是否已经发出、方法是否被服务端标记为幂等，以及调用的错误
+func (p *RetryPolicy) do(ctx context.Context, serviceMethod string, attempt func() (sent, idempotent bool, err error)) error {
+	if p.Budget != nil {
+		p.Budget.deposit()
+	}
+	for n := 1; ; n++ {
+		sent, idempotent, err := attempt()
+		if err == nil || n >= p.maxAttempts() || ctx.Err() != nil || !p.retryable(err) {
+			return err
+		}
+		if p.Idempotent != nil && p.Idempotent(serviceMethod) {
+			idempotent = true
+		}
+		// 服务端过载时在执行之前就拒绝了请求，相当于没有发出
+		retryAfter := retryAfterOf(err)
+		if sent && !idempotent && retryAfter == 0 {
+			return err
+		}
+		if p.Budget != nil && !p.Budget.withdraw() {
+			return err
+		}
+		wait := p.backoff(n - 1)
+		if wait < retryAfter {
+			wait = retryAfter
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(wait):
+		}
+	}
+}
+
+// RetryBudget 重试预算
+// 每次调用存入Ratio个令牌，每次重试取出一个令牌，令牌不足时不再重试，
+// 所以长期来看重试次数不会超过调用次数的Ratio倍。
+// 令牌最多攒到Burst个，刚启动时也有Burst个令牌可用
+type RetryBudget struct {
+	ratio float64
+	burst float64
+
+	mu     sync.Mutex
+	tokens float64
+}
+
+// NewRetryBudget 创建一个重试预算，ratio为允许的重试次数与调用次数之比
+func NewRetryBudget(ratio float64, burst int) *RetryBudget {
+	return &RetryBudget{
+		ratio:  ratio,
+		burst:  float64(burst),
+		tokens: float64(burst),
+	}
+}
+
+func (b *RetryBudget) deposit() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens += b.ratio
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+}
+
+func (b *RetryBudget) withdraw() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
@@ -0,0 +1,133 @@
+package geerpc
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// flakyServer 注册总是返回CodeUnavailable的方法，返回每个方法被调用的次数
+func flakyServer(t *testing.T) (addr string, calls map[string]*int32) {
+	server := NewServer()
+	calls = make(map[string]*int32)
+	for _, name := range []string{"Once", "Idem", "Client"} {
+		n := new(int32)
+		calls[name] = n
+		var opt *MethodOption
+		if name == "Idem" {
+			opt = &MethodOption{Idempotent: true}
+		}
+		if err := server.HandleFunc("Flaky."+name, func(args int, reply *int) error {
+			atomic.AddInt32(n, 1)
+			return Errorf(CodeUnavailable, "try again")
+		}, opt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return startServer(t, server), calls
+}
+
+func TestRetry(t *testing.T) {
+	addr, calls := flakyServer(t)
+	client := dialTest(t, addr, &Option{Retry: &RetryPolicy{
+		MaxAttempts:    3,
+		InitialBackoff: time.Millisecond,
+		Idempotent:     func(serviceMethod string) bool { return serviceMethod == "Flaky.Client" },
+	}})
+	var reply int
+	for _, name := range []string{"Once", "Idem", "Client"} {
+		if err := client.Call("Flaky."+name, 1, &reply); CodeOf(err) != CodeUnavailable {
+			t.Fatalf("Flaky.%s err = %v", name, err)
+		}
+	}
+	// 已经发出的非幂等调用不会重试，服务端或客户端标记为幂等的方法重试到MaxAttempts
+	want := map[string]int32{"Once": 1, "Idem": 3, "Client": 3}
+	for name, n := range want {
+		if got := atomic.LoadInt32(calls[name]); got != n {
+			t.Errorf("Flaky.%s called %d times, want %d", name, got, n)
+		}
+	}
+}
+
+func TestRetryBudget(t *testing.T) {
+	addr, calls := flakyServer(t)
+	// 没有新的令牌，只能用掉最开始的2个
+	client := dialTest(t, addr, &Option{Retry: &RetryPolicy{
+		MaxAttempts:    3,
+		InitialBackoff: time.Millisecond,
+		Budget:         NewRetryBudget(0, 2),
+	}})
+	var reply int
+	for i := 0; i < 3; i++ {
+		_ = client.Call("Flaky.Idem", 1, &reply)
+	}
+	// 第一次调用重试2次用完预算，之后的调用不再重试
+	if got := atomic.LoadInt32(calls["Idem"]); got != 5 {
+		t.Fatalf("Flaky.Idem called %d times, want 5", got)
+	}
+}
+
+func TestRetryBudgetRatio(t *testing.T) {
+	b := NewRetryBudget(0.5, 10)
+	for b.withdraw() {
+	}
+	// 预算用完后，每两次调用攒够一次重试
+	for i := 0; i < 4; i++ {
+		b.deposit()
+	}
+	if !b.withdraw() || !b.withdraw() || b.withdraw() {
+		t.Fatal("budget should allow exactly 2 retries after 4 calls with ratio 0.5")
+	}
+	// 最多攒到burst个
+	for i := 0; i < 100; i++ {
+		b.deposit()
+	}
+	var n int
+	for b.withdraw() {
+		n++
+	}
+	if n != 10 {
+		t.Fatalf("withdrew %d tokens, want burst 10", n)
+	}
+}
+
+func TestRetryPolicyDo(t *testing.T) {
+	p := &RetryPolicy{MaxAttempts: 4, InitialBackoff: time.Millisecond}
+	unavailable := Errorf(CodeUnavailable, "unavailable")
+	tests := []struct {
+		name       string
+		sent       bool
+		idempotent bool
+		err        error
+		attempts   int
+	}{
+		{"not sent", false, false, unavailable, 4},
+		{"sent non-idempotent", true, false, unavailable, 1},
+		{"sent idempotent", true, true, unavailable, 4},
+		{"not retryable code", false, true, Errorf(CodeInvalidArgument, "bad"), 1},
+		{"overloaded before execution", true, false, &Error{Code: CodeUnavailable, RetryAfter: time.Millisecond}, 4},
+	}
+	for _, tt := range tests {
+		var n int
+		err := p.do(context.Background(), "Svc.M", func() (bool, bool, error) {
+			n++
+			return tt.sent, tt.idempotent, tt.err
+		})
+		if err != tt.err || n != tt.attempts {
+			t.Errorf("%s: attempts = %d, err = %v, want %d attempts", tt.name, n, err, tt.attempts)
+		}
+	}
+
+	// ctx结束后不再等待重试
+	ctx, cancel := context.WithCancel(context.Background())
+	var n int
+	_ = (&RetryPolicy{MaxAttempts: 10, InitialBackoff: time.Hour}).do(ctx, "Svc.M", func() (bool, bool, error) {
+		n++
+		cancel()
+		return false, false, unavailable
+	})
+	if n != 1 {
+		t.Fatalf("attempts after cancel = %d, want 1", n)
+	}
+}
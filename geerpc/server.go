@@ -1,14 +1,20 @@
 package geerpc
 
 import (
+	"bufio"
+	"context"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"geerpc/codec"
 	"io"
-	"log"
 	"net"
 	"reflect"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 const MagicNumber = 0x3bef5c
@@ -16,6 +22,26 @@ const MagicNumber = 0x3bef5c
 type Option struct {
 	MagicNumber int        // MagicNumber marks this's a geerpc request
 	CodecType   codec.Type // client may choose different Codec to encode body
+	// 客户端的认证信息，由Credentials生成，服务端交给Authenticator校验
+	Auth map[string]string `json:",omitempty"`
+
+	// 以下是客户端本地的配置，不会发送给服务端
+	Retry *RetryPolicy `json:"-"` // 调用失败时的重试策略，nil表示不重试
+	// 非nil时使用TLS连接服务端，需要校验客户端证书的服务端还要在这里配置客户端证书
+	TLSConfig *tls.Config `json:"-"`
+	// 每次建立连接时生成认证信息，填入Auth
+	Credentials Credentials `json:"-"`
+	// 客户端的指标，nil表示不收集
+	Metrics Metrics `json:"-"`
+	// 客户端的链路追踪，nil表示不追踪
+	Tracer Tracer `json:"-"`
+	// 客户端的日志，nil表示不输出日志
+	Logger Logger `json:"-"`
+	// 限制每一帧响应的大小，nil表示使用codec.DefaultLimits
+	// 响应超过限制时对应的调用返回CodeResourceExhausted错误，连接可以继续使用
+	Limits *codec.Limits `json:"-"`
+	// 连接空闲时发送ping检测连接是否断开，nil表示不检测
+	KeepAlive *KeepAliveOption `json:"-"`
 }
 
 var DefaultOption = &Option{
@@ -23,24 +49,179 @@ var DefaultOption = &Option{
 	CodecType:   codec.GobType,
 }
 
+// ServerOption 服务端的配置
+type ServerOption struct {
+	Limit     Limit // 整个服务端的限流
+	ConnLimit Limit // 每个连接的限流，防止单个客户端占满服务端
+	// 自适应降载，nil表示不开启
+	Shed *ShedOption
+	// 握手时认证客户端，nil表示不认证
+	Auth Authenticator
+	// 服务端的指标，nil表示不收集
+	Metrics Metrics
+	// 服务端的链路追踪，nil表示不追踪
+	Tracer Tracer
+	// 服务端的日志，nil表示不输出日志
+	Logger Logger
+	// 访问日志，nil表示不记录
+	AccessLog *AccessLogOption
+	// 调试模式，服务方法panic时把调用栈也返回给客户端
+	Debug bool
+	// 限制每一帧请求的大小和嵌套深度，nil表示使用codec.DefaultLimits
+	// 超过限制的请求会收到CodeResourceExhausted错误，body超过限制时连接可以继续使用，header超过限制时连接被关闭
+	Limits *codec.Limits
+	// 连接上超过这个时间没有收到报文，并且没有正在处理的调用时关闭连接，0表示不关闭
+	IdleTimeout time.Duration
+	// 建立连接后完成握手的时间，包括TLS握手、读取Option和认证，默认10s
+	// 防止没有通过认证的客户端一直占着连接和协程
+	HandshakeTimeout time.Duration
+	// 不注册内置的反射服务ReflectionService，不希望客户端看到服务和方法列表时使用
+	DisableReflection bool
+}
+
 // Server represents an RPC Server.
-type Server struct{}
+type Server struct {
+	opt *ServerOption
+	// 已注册的服务，key为服务名
+	serviceMap sync.Map
+	funcMu     sync.Mutex // HandleFunc修改函数服务时加锁
+	limiter    *limiter
+	shedder    *adaptiveLimiter
+	logger     Logger
+	accessLog  *accessLogger
+	numPanics  uint64 // 服务方法panic的总次数
+
+	mu        sync.Mutex // protect following
+	listeners map[net.Listener]struct{}
+	conns     map[*serverConn]struct{}
+	shutdown  bool
+}
 
 // NewServer returns a new Server.
-func NewServer() *Server {
-	return &Server{}
+// opts可以对服务端做额外的配置，最多只使用第一个
+func NewServer(opts ...*ServerOption) *Server {
+	opt := &ServerOption{}
+	if len(opts) > 0 && opts[0] != nil {
+		o := *opts[0]
+		opt = &o
+	}
+	server := &Server{
+		opt:       opt,
+		limiter:   newLimiter(opt.Limit),
+		shedder:   newAdaptiveLimiter(opt.Shed),
+		logger:    orNop(opt.Logger),
+		accessLog: newAccessLogger(opt.AccessLog, orNop(opt.Logger)),
+		listeners: make(map[net.Listener]struct{}),
+		conns:     make(map[*serverConn]struct{}),
+	}
+	builtin := newBuiltinService("_rpc", &rpcBuiltin{})
+	server.serviceMap.Store(builtin.name, builtin)
+	if !opt.DisableReflection {
+		r := newBuiltinService(ReflectionService, &reflection{server: server})
+		server.serviceMap.Store(r.name, r)
+	}
+	return server
 }
 
 // DefaultServer is the default instance of *Server.
 var DefaultServer = NewServer()
 
+// Register publishes in the server the set of methods of the
+// receiver value that satisfy the following conditions:
+//   - exported method of exported type
+//   - two arguments, both of exported type
+//   - the second argument is a pointer
+//   - one return value, of type error
+//
+// 或者是只有一个*ServerStream参数、返回error的流方法
+// opts可以对单个方法做额外的配置，最多只能传一个
+func (server *Server) Register(rcvr interface{}, opts ...*ServiceOption) error {
+	s, err := newService(rcvr)
+	if err != nil {
+		return err
+	}
+	return server.register(s, opts...)
+}
+
+// register 应用方法的配置，并把服务加入服务表
+func (server *Server) register(s *service, opts ...*ServiceOption) error {
+	if len(opts) > 1 {
+		return errors.New("rpc: number of service options is more than 1")
+	}
+	if len(opts) == 1 && opts[0] != nil {
+		if err := s.applyOption(opts[0]); err != nil {
+			return err
+		}
+	}
+	if _, dup := server.serviceMap.LoadOrStore(s.name, s); dup {
+		return errors.New("rpc: service already defined: " + s.name)
+	}
+	for name, m := range s.method {
+		server.logger.Log(LevelDebug, "rpc server: register",
+			LogKeyMethod, s.name+"."+name, "stream", m.streaming)
+	}
+	return nil
+}
+
+// Register publishes the receiver's methods in the DefaultServer.
+func Register(rcvr interface{}, opts ...*ServiceOption) error {
+	return DefaultServer.Register(rcvr, opts...)
+}
+
+// ServiceOption 注册服务时的配置
+type ServiceOption struct {
+	// 对单个方法的配置，key为方法名（不包含服务名）
+	Methods map[string]*MethodOption
+}
+
+// MethodOption 对单个方法的配置
+type MethodOption struct {
+	// 幂等的方法执行多次和执行一次的效果相同，
+	// 客户端在请求已经发出后仍然可以安全地重试
+	Idempotent bool
+	// 这个方法的限流，和连接、服务端的限流同时生效
+	Limit Limit
+	// 允许调用这个方法的角色，调用方拥有其中任意一个即可，空表示不限制
+	// 角色来自ServerOption.Auth认证的结果，没有配置认证时所有的调用都会被拒绝
+	Roles []string
+}
+
+// findService 根据"Service.Method"找到对应的服务和方法
+func (server *Server) findService(serviceMethod string) (svc *service, mtype *methodType, err error) {
+	dot := strings.LastIndex(serviceMethod, ".")
+	if dot < 0 {
+		err = Errorf(CodeNotFound, "rpc server: service/method request ill-formed: %s", serviceMethod)
+		return
+	}
+	serviceName, methodName := serviceMethod[:dot], serviceMethod[dot+1:]
+	svci, ok := server.serviceMap.Load(serviceName)
+	if !ok {
+		err = Errorf(CodeNotFound, "rpc server: can't find service %s", serviceName)
+		return
+	}
+	svc = svci.(*service)
+	mtype = svc.method[methodName]
+	if mtype == nil {
+		err = Errorf(CodeNotFound, "rpc server: can't find method %s", methodName)
+	}
+	return
+}
+
 // Accept accepts connections on the listener and serves requests
 // for each incoming connection.
+// Accept returns after Shutdown is called.
 func (server *Server) Accept(lis net.Listener) {
+	if !server.trackListener(lis, true) {
+		_ = lis.Close()
+		return
+	}
+	defer server.trackListener(lis, false)
 	for {
 		conn, err := lis.Accept()
 		if err != nil {
-			log.Println("rpc server: accept error:", err)
+			if !server.shuttingDown() {
+				server.logger.Log(LevelError, "rpc server: accept error", LogKeyError, err)
+			}
 			return
 		}
 		go server.ServeConn(conn)
@@ -51,59 +232,272 @@ func (server *Server) Accept(lis net.Listener) {
 // for each incoming connection.
 func Accept(lis net.Listener) { DefaultServer.Accept(lis) }
 
+// defaultHandshakeTimeout ServerOption.HandshakeTimeout的默认值
+const defaultHandshakeTimeout = 10 * time.Second
 
 // ServeConn runs the server on a single connection.
 // ServeConn blocks, serving the connection until the client hangs up.
+// conn是*tls.Conn时先完成握手，对方的证书可以在服务方法中通过PeerFromContext获取
 func (server *Server) ServeConn(conn io.ReadWriteCloser) {
 	defer func() { _ = conn.Close() }()
+	p := &Peer{}
+	nc, _ := conn.(net.Conn)
+	if nc != nil {
+		p.Addr = nc.RemoteAddr()
+		timeout := server.opt.HandshakeTimeout
+		if timeout <= 0 {
+			timeout = defaultHandshakeTimeout
+		}
+		_ = nc.SetDeadline(time.Now().Add(timeout))
+	}
+	if tc, ok := conn.(*tls.Conn); ok {
+		if err := tc.Handshake(); err != nil {
+			server.logger.Log(LevelWarn, "rpc server: tls handshake error", LogKeyRemote, p.remote(), LogKeyError, err)
+			return
+		}
+		state := tc.ConnectionState()
+		p.TLS = &state
+	}
+
 	var opt Option
-	// @todo 这里一定会读取到完整的option段？
-	if err := json.NewDecoder(conn).Decode(&opt); err != nil {
-		log.Println("rpc server: options error: ", err)
+	// json解码器自带缓冲，可能会多读取option之后的报文
+	// option和header一样受MaxHeaderSize的限制
+	limits := limitsOf(server.opt.Limits)
+	var or io.Reader = conn
+	if limits.MaxHeaderSize > 0 {
+		or = io.LimitReader(conn, int64(limits.MaxHeaderSize))
+	}
+	dec := json.NewDecoder(or)
+	if err := dec.Decode(&opt); err != nil {
+		server.logger.Log(LevelWarn, "rpc server: options error", LogKeyRemote, p.remote(), LogKeyError, err)
 		return
 	}
 
 	// @todo 这个魔数有什么用？
 	if opt.MagicNumber != MagicNumber {
-		log.Printf("rpc server: invalid magic number %x", opt.MagicNumber)
+		server.logger.Log(LevelWarn, "rpc server: invalid magic number", LogKeyRemote, p.remote(),
+			"magic", fmt.Sprintf("%x", opt.MagicNumber))
 		return
 	}
 
 	// 根据option段指定的编码类型，获取相应编码器的构造方法
 	f := codec.NewCodecFuncMap[opt.CodecType]
 	if f == nil {
-		log.Printf("rpc server: invalid codec type %s", opt.CodecType)
+		server.logger.Log(LevelWarn, "rpc server: invalid codec type", LogKeyRemote, p.remote(), LogKeyCodec, opt.CodecType)
 		return
 	}
 	// 调用上面获取到的构造方法，实例化一个解码器
-	server.serveCodec(f(conn))
+	// json解码器中缓冲的内容属于后面的报文，要先读取
+	// 客户端的json.Encoder会在option后面写一个换行符，需要跳过
+	r := bufio.NewReader(io.MultiReader(dec.Buffered(), conn))
+	if b, err := r.Peek(1); err == nil && b[0] == '\n' {
+		_, _ = r.Discard(1)
+	}
+	bc := &bufferedConn{r: r, ReadWriteCloser: conn}
+	cc := f(bc)
+	setLimits(cc, limits)
+	if server.opt.Auth != nil {
+		info, err := server.opt.Auth.Authenticate(newPeerContext(context.Background(), p), &opt)
+		if err != nil {
+			server.reject(cc, bc, p, err)
+			return
+		}
+		p.Auth = info
+	}
+	if nc != nil {
+		// 握手完成，之后由IdleTimeout和keepalive处理不活跃的连接
+		_ = nc.SetDeadline(time.Time{})
+	}
+	server.serveCodec(cc, bc, &opt, p)
+}
+
+// reject 认证失败时告诉客户端原因，然后关闭连接
+func (server *Server) reject(cc codec.Codec, conn *bufferedConn, p *Peer, err error) {
+	server.logger.Log(LevelWarn, "rpc server: authentication error", LogKeyRemote, p.remote(), LogKeyError, err)
+	var e *Error
+	if !errors.As(err, &e) {
+		err = Errorf(CodeUnauthenticated, "rpc server: %v", err)
+	}
+	h := &codec.Header{Frame: codec.FrameGoAway}
+	setError(h, err)
+	nc, ok := conn.ReadWriteCloser.(net.Conn)
+	if cc.Write(h, emptyBody) == nil && ok {
+		// 客户端可能已经发出了请求，直接关闭会因为还有没读取的数据而发送RST，
+		// 客户端来不及读到错误原因。等客户端收到错误后断开，最多等一秒
+		_ = nc.SetReadDeadline(time.Now().Add(time.Second))
+		_, _ = io.Copy(io.Discard, conn)
+	}
+	_ = cc.Close()
+}
+
+// bufferedConn 先从r中读取，写入和关闭仍然使用原来的连接
+// 实现了io.ByteReader，gob不会再加一层缓冲，所以read就是编解码器实际读取的字节数
+type bufferedConn struct {
+	r *bufio.Reader
+	io.ReadWriteCloser
+	read int // 只在读取报文的协程中访问
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.read += n
+	return n, err
+}
+
+func (c *bufferedConn) ReadByte() (byte, error) {
+	b, err := c.r.ReadByte()
+	if err == nil {
+		c.read++
+	}
+	return b, err
 }
 
 // invalidRequest is a placeholder for response argv when error occurs
 var invalidRequest = struct{}{}
 
-func (server *Server) serveCodec(cc codec.Codec) {
-	sending := new(sync.Mutex) // make sure to send a complete response
+// serverConn 记录服务端一个连接上的状态
+// 普通调用和流共用同一个连接，都通过写协程w发送
+type serverConn struct {
+	cc      codec.Codec
+	conn    *bufferedConn
+	opt     *Option
+	metrics Metrics
+	limiter *limiter
+	peer    *Peer
+	// 服务方法收到的ctx，带有对方的信息，连接断开时取消
+	ctx    context.Context
+	cancel context.CancelFunc
+	w      *connWriter    // make sure to send a complete response
+	wg     sync.WaitGroup // wait until all request are handled
+	// 开始读取当前这一帧时conn.read的值，用于计算这一帧的大小
+	readMark int
+	// 用于关闭空闲连接，都通过atomic访问
+	lastActive int64 // 最近一次收到报文或者调用结束的时间
+	active     int32 // 正在处理的调用和流
+	idle       int32 // 1表示连接因为空闲被关闭
+	draining   int32 // 1表示服务端正在关闭，已经发送了FrameGoAway
+
+	mu         sync.Mutex // protect following
+	streams    map[uint64]*ServerStream
+	drainTimer *time.Timer // 服务端正在关闭时，调用和流都结束后关闭连接的定时器
+}
+
+// write 完整地发送一帧报文
+func (sc *serverConn) write(h *codec.Header, body interface{}) error {
+	_, err := sc.writeN(h, body)
+	return err
+}
 
-	// WaitGroup：等待所有子协程处理完毕后，再结束主协程
-	wg := new(sync.WaitGroup)  // wait until all request are handled
+// writeN 和write一样，同时返回这一帧的字节数
+func (sc *serverConn) writeN(h *codec.Header, body interface{}) (int, error) {
+	n, err := sc.w.write(h, body)
+	if sc.metrics != nil && n > 0 {
+		sc.metrics.ServerBytes(sc.opt.CodecType, 0, n)
+	}
+	return n, err
+}
+
+// frameSize 当前这一帧已经读取的字节数
+func (sc *serverConn) frameSize() int {
+	return sc.conn.read - sc.readMark
+}
+
+// reportRead 一帧读取完毕，记录读取的字节数
+func (sc *serverConn) reportRead() {
+	if sc.metrics != nil && sc.frameSize() > 0 {
+		sc.metrics.ServerBytes(sc.opt.CodecType, sc.frameSize(), 0)
+	}
+}
+
+func (sc *serverConn) stream(seq uint64) *ServerStream {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	return sc.streams[seq]
+}
+
+func (sc *serverConn) removeStream(seq uint64) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	delete(sc.streams, seq)
+}
+
+func (server *Server) serveCodec(cc codec.Codec, conn *bufferedConn, opt *Option, p *Peer) {
+	ctx, cancel := context.WithCancel(newPeerContext(context.Background(), p))
+	defer cancel()
+	sc := &serverConn{
+		cc:      cc,
+		conn:    conn,
+		w:       newConnWriter(cc),
+		opt:     opt,
+		metrics: server.opt.Metrics,
+		limiter: newLimiter(server.opt.ConnLimit),
+		peer:    p,
+		ctx:     ctx,
+		cancel:  cancel,
+		streams: make(map[uint64]*ServerStream),
+	}
+	if !server.trackConn(sc, true) {
+		// 服务端正在关闭，不再接受新的连接
+		sc.w.close()
+		_ = cc.Close()
+		return
+	}
+	defer server.trackConn(sc, false)
+	if timeout := server.opt.IdleTimeout; timeout > 0 {
+		sc.touch()
+		defer server.watchIdle(sc, timeout)()
+	}
 	for {
 		// 一次连接可能会发送多次请求：即多个header和body
 		// 这里无限循环等待请求到来，直到连接被关闭
-		req, err := server.readRequest(cc)
+		sc.readMark = sc.conn.read
+		h, err := server.readRequestHeader(sc)
+		if err != nil {
+			break // it's not possible to recover, so close the connection
+		}
+		sc.touch()
+		if h.Frame != codec.FrameCall {
+			// 流相关的报文
+			err = server.handleFrame(sc, h)
+			freeHeader(h)
+			sc.reportRead()
+			if err != nil {
+				break
+			}
+			continue
+		}
+		req, err := server.readRequest(sc, h)
+		sc.reportRead()
 		if err != nil {
 			if req == nil {
-				break // it's not possible to recover, so close the connection
+				break
 			}
-			req.h.Error = err.Error()
-			server.sendResponse(cc, req.h, invalidRequest, sending)
+			setError(req.h, err)
+			req.respSize = server.sendResponse(sc, req.h, invalidRequest)
+			req.done(err)
+			req.free()
 			continue
 		}
-		wg.Add(1)
-		go server.handleRequest(cc, req, sending, wg)
+		sc.wg.Add(1)
+		sc.busy(1)
+		go server.handleRequest(sc, req)
 	}
+	// 连接已经不可用，结束所有还在进行的流和调用
+	sc.cancel()
+	sc.mu.Lock()
+	for _, ss := range sc.streams {
+		ss.st.fail(ErrShutdown)
+	}
+	sc.mu.Unlock()
+
 	// 等待所有子协程处理完毕，然后关闭连接
-	wg.Wait()
+	sc.wg.Wait()
+	sc.mu.Lock()
+	if sc.drainTimer != nil {
+		sc.drainTimer.Stop()
+	}
+	sc.mu.Unlock()
+	sc.w.close()
 	_ = cc.Close()
 }
 
@@ -111,48 +505,288 @@ func (server *Server) serveCodec(cc codec.Codec) {
 type request struct {
 	h            *codec.Header // header of request
 	argv, replyv reflect.Value // argv and replyv of request
+	mtype        *methodType
+	svc          *service
+	release      func()          // 释放限流的名额
+	done         func(err error) // 处理结束时记录指标、结束span和记录访问日志
+	ctx          context.Context // 服务方法收到的ctx
+	reqSize      int             // 请求的字节数，包括请求头
+	respSize     int             // 响应的字节数，包括响应头
+}
+
+// 每一帧都需要一个header，每次调用都需要一个request，复用它们减少GC的压力
+var (
+	headerPool  = sync.Pool{New: func() interface{} { return new(codec.Header) }}
+	requestPool = sync.Pool{New: func() interface{} { return new(request) }}
+)
+
+// freeHeader 清空header并放回池中
+func freeHeader(h *codec.Header) {
+	*h = codec.Header{}
+	headerPool.Put(h)
 }
 
-func (server *Server) readRequestHeader(cc codec.Codec) (*codec.Header, error) {
-	var h codec.Header
-	if err := cc.ReadHeader(&h); err != nil {
-		if err != io.EOF && err != io.ErrUnexpectedEOF {
-			log.Println("rpc server: read header error:", err)
+// sizes 请求和响应的字节数
+func (req *request) sizes() (int, int) {
+	return req.reqSize, req.respSize
+}
+
+// free 调用处理完毕、响应已经发出后，把request和header放回池中
+func (req *request) free() {
+	freeHeader(req.h)
+	*req = request{}
+	requestPool.Put(req)
+}
+
+func (server *Server) readRequestHeader(sc *serverConn) (*codec.Header, error) {
+	h := headerPool.Get().(*codec.Header)
+	if err := sc.cc.ReadHeader(h); err != nil {
+		// 关闭服务端时强制关闭连接导致的错误不需要记录
+		if err != io.EOF && err != io.ErrUnexpectedEOF && !server.shuttingDown() && !sc.closedIdle() {
+			server.logger.Log(LevelWarn, "rpc server: read header error", LogKeyRemote, sc.peer.remote(), LogKeyError, err)
 		}
+		freeHeader(h)
 		return nil, err
 	}
-	return &h, nil
+	return h, nil
 }
 
-func (server *Server) readRequest(cc codec.Codec) (*request, error) {
-	//
-	h, err := server.readRequestHeader(cc)
+func (server *Server) readRequest(sc *serverConn, h *codec.Header) (*request, error) {
+	cc := sc.cc
+	req := requestPool.Get().(*request)
+	req.h = h
+	var err error
+	req.svc, req.mtype, err = server.findService(h.ServiceMethod)
+	req.done = observeServer(server.opt.Metrics, h.ServiceMethod, err == nil)
+	req.ctx = sc.ctx
+	if t := server.opt.Tracer; t != nil {
+		req.ctx, req.done = server.traceRequest(sc, t, h, req.done)
+	}
+	if server.accessLog != nil {
+		req.done = server.accessLog.wrap(sc, h.ServiceMethod, h.Seq, req.sizes, req.done)
+	}
+	// 响应头复用请求头，元数据不需要再发回给客户端
+	h.Meta = nil
+	if err == nil && req.mtype.streaming {
+		err = Errorf(CodeInvalidArgument, "rpc server: %s is a streaming method", h.ServiceMethod)
+	}
+	if req.mtype != nil {
+		h.Idempotent = req.mtype.idempotent
+	}
+	if err == nil {
+		err = authorize(sc.peer, req.mtype)
+	}
+	if err == nil {
+		// 在读取body之前判断是否超出限制，超出时不再为参数分配内存
+		req.release, err = server.admit(sc, req.svc, req.mtype)
+	}
 	if err != nil {
-		return nil, err
+		// 丢弃body，保证下一次读取的是header
+		rerr := cc.ReadBody(nil)
+		req.reqSize = sc.frameSize()
+		// 超过大小限制的body已经被丢弃，不影响下一个请求
+		if rerr != nil && !errors.Is(rerr, codec.ErrTooLarge) {
+			req.done(rerr)
+			return nil, rerr
+		}
+		return req, err
 	}
-	req := &request{h: h}
-	// TODO: now we don't know the type of request argv
-	// day 1, just suppose it's string
-	req.argv = reflect.New(reflect.TypeOf(""))
-	if err = cc.ReadBody(req.argv.Interface()); err != nil {
-		log.Println("rpc server: read argv err:", err)
+	req.argv = req.mtype.newArgv()
+	req.replyv = req.mtype.newReplyv()
+
+	// make sure that argvi is a pointer, ReadBody need a pointer as parameter
+	argvi := req.argv.Interface()
+	if req.argv.Type().Kind() != reflect.Ptr {
+		argvi = req.argv.Addr().Interface()
+	}
+	err = cc.ReadBody(argvi)
+	req.reqSize = sc.frameSize()
+	if err != nil {
+		server.logger.Log(LevelWarn, "rpc server: read body error", LogKeyRemote, sc.peer.remote(),
+			LogKeyMethod, h.ServiceMethod, LogKeySeq, h.Seq, LogKeyError, err)
+		req.release()
+		if errors.Is(err, codec.ErrTooLarge) || errors.Is(err, codec.ErrTooDeep) {
+			// 编解码器已经丢弃了超过大小限制的body，连接可以继续读取下一个请求
+			return req, Errorf(CodeResourceExhausted, "rpc server: read body err: %v", err)
+		}
+		return req, Errorf(CodeInvalidArgument, "rpc server: read body err: %v", err)
 	}
 	return req, nil
 }
 
-func (server *Server) sendResponse(cc codec.Codec, h *codec.Header, body interface{}, sending *sync.Mutex) {
-	sending.Lock()
-	defer sending.Unlock()
-	if err := cc.Write(h, body); err != nil {
-		log.Println("rpc server: write response error:", err)
+// setError 把错误信息和错误码写入响应头
+func setError(h *codec.Header, err error) {
+	h.Error = err.Error()
+	h.Code = uint32(CodeOf(err))
+	var e *Error
+	if errors.As(err, &e) && e.RetryAfter > 0 {
+		h.RetryAfter = uint32((e.RetryAfter + time.Millisecond - 1) / time.Millisecond)
+	}
+}
+
+// sendResponse 发送响应，返回响应的字节数
+func (server *Server) sendResponse(sc *serverConn, h *codec.Header, body interface{}) int {
+	n, err := sc.writeN(h, body)
+	if err != nil {
+		server.logger.Log(LevelWarn, "rpc server: write response error", LogKeyRemote, sc.peer.remote(),
+			LogKeyMethod, h.ServiceMethod, LogKeySeq, h.Seq, LogKeyError, err)
 	}
+	return n
 }
 
-func (server *Server) handleRequest(cc codec.Codec, req *request, sending *sync.Mutex, wg *sync.WaitGroup) {
-	// TODO, should call registered rpc methods to get the right replyv
-	// day 1, just print argv and send a hello message
-	defer wg.Done()
-	log.Println(req.h, req.argv.Elem())
-	req.replyv = reflect.ValueOf(fmt.Sprintf("geerpc resp %d", req.h.Seq))
-	server.sendResponse(cc, req.h, req.replyv.Interface(), sending)
-}
\ No newline at end of file
+func (server *Server) handleRequest(sc *serverConn, req *request) {
+	defer sc.wg.Done()
+	defer req.free()
+	defer sc.busy(-1)
+	defer req.release()
+	reply, err := req.svc.call(req.ctx, req.mtype, req.argv, req.replyv)
+	err = server.recovered(sc, req.h.Seq, err)
+	defer func() { req.done(err) }()
+	if err != nil {
+		setError(req.h, err)
+		req.respSize = server.sendResponse(sc, req.h, invalidRequest)
+		return
+	}
+	req.respSize = server.sendResponse(sc, req.h, reply)
+}
+
+// handleFrame 处理流相关的报文
+// 只有在连接不可用时才返回错误
+func (server *Server) handleFrame(sc *serverConn, h *codec.Header) error {
+	if h.Frame == codec.FrameStreamOpen {
+		// 打开流的报文没有内容
+		if err := sc.cc.ReadBody(nil); err != nil {
+			return err
+		}
+		svc, mtype, err := server.findService(h.ServiceMethod)
+		ss := &ServerStream{
+			ctx:           sc.ctx,
+			ServiceMethod: h.ServiceMethod,
+			reqSize:       int64(sc.frameSize()),
+		}
+		ss.st = newStream(h.Seq, sc.opt.CodecType, ss.writeTo(sc))
+		// 流和普通调用一样记录指标、链路追踪和访问日志，流结束时调用done
+		done := observeServer(server.opt.Metrics, h.ServiceMethod, err == nil)
+		if t := server.opt.Tracer; t != nil {
+			ss.ctx, done = server.traceRequest(sc, t, h, done)
+		}
+		if server.accessLog != nil {
+			done = server.accessLog.wrap(sc, h.ServiceMethod, h.Seq, ss.sizes, done)
+		}
+		if err == nil && !mtype.streaming {
+			err = Errorf(CodeInvalidArgument, "rpc server: %s is not a streaming method", h.ServiceMethod)
+		}
+		if err == nil {
+			err = authorize(sc.peer, mtype)
+		}
+		// 流在整个生命周期内都占用一个并发名额
+		var release func()
+		if err == nil {
+			release, err = server.admit(sc, svc, mtype)
+		}
+		if err != nil {
+			h.Frame = codec.FrameStreamEnd
+			setError(h, err)
+			ss.respSize = int64(server.sendResponse(sc, h, emptyBody))
+			done(err)
+			return nil
+		}
+		sc.mu.Lock()
+		sc.streams[h.Seq] = ss
+		sc.mu.Unlock()
+		sc.wg.Add(1)
+		sc.busy(1)
+		go func() {
+			defer release()
+			server.handleStream(sc, svc, mtype, ss, done)
+		}()
+		return nil
+	}
+
+	// 流可能已经结束，此时ss为nil，报文直接丢弃
+	ss := sc.stream(h.Seq)
+	switch h.Frame {
+	case codec.FrameStreamData:
+		var data []byte
+		if err := sc.cc.ReadBody(&data); err != nil {
+			return err
+		}
+		if ss != nil {
+			atomic.AddInt64(&ss.reqSize, int64(sc.frameSize()))
+			if err := ss.st.deliver(data); err != nil {
+				ss.st.fail(err)
+			}
+		}
+		return nil
+	case codec.FrameStreamEnd:
+		if ss != nil {
+			ss.st.closeRecv(nil)
+		}
+	case codec.FrameStreamReset:
+		if ss != nil {
+			ss.st.fail(ErrStreamReset)
+		}
+	case codec.FrameWindow:
+		if ss != nil {
+			ss.st.addWindow(h.Window)
+		}
+	}
+	return sc.cc.ReadBody(nil)
+}
+
+// handleStream 调用流方法，方法返回后告诉客户端流已经结束
+func (server *Server) handleStream(sc *serverConn, svc *service, mtype *methodType, ss *ServerStream, done func(error)) {
+	defer sc.wg.Done()
+	defer sc.busy(-1)
+	err := svc.callStream(mtype, ss)
+	err = server.recovered(sc, ss.st.seq, err)
+	defer done(err)
+	sc.removeStream(ss.st.seq)
+	ss.st.fail(ErrStreamClosed)
+
+	h := &codec.Header{ServiceMethod: ss.ServiceMethod, Seq: ss.st.seq, Frame: codec.FrameStreamEnd}
+	if err != nil {
+		setError(h, err)
+	}
+	atomic.AddInt64(&ss.respSize, int64(server.sendResponse(sc, h, emptyBody)))
+}
+
+// recovered 服务方法panic时记录日志，并转换成发送给客户端的CodeInternal错误
+// 其他错误原样返回
+func (server *Server) recovered(sc *serverConn, seq uint64, err error) error {
+	pe, ok := err.(*panicError)
+	if !ok {
+		return err
+	}
+	atomic.AddUint64(&server.numPanics, 1)
+	server.logger.Log(LevelError, "rpc server: handler panic", LogKeyRemote, sc.peer.remote(),
+		LogKeyMethod, pe.serviceMethod, LogKeySeq, seq, LogKeyError, pe.value, "stack", string(pe.stack))
+	if server.opt.Debug {
+		return Errorf(CodeInternal, "%s\n%s", pe.Error(), pe.stack)
+	}
+	return Errorf(CodeInternal, "%s", pe.Error())
+}
+
+// NumPanics 服务方法panic的总次数
+func (server *Server) NumPanics() uint64 {
+	return atomic.LoadUint64(&server.numPanics)
+}
+
+// limitsOf 返回补全默认值后的报文限制
+func limitsOf(l *codec.Limits) codec.Limits {
+	if l == nil {
+		return codec.DefaultLimits
+	}
+	o := *l
+	if o.MaxHeaderSize == 0 {
+		o.MaxHeaderSize = codec.DefaultLimits.MaxHeaderSize
+	}
+	return o
+}
+
+// setLimits 编解码器支持时，限制读取的报文大小
+func setLimits(cc codec.Codec, l codec.Limits) {
+	if lc, ok := cc.(codec.LimitedCodec); ok {
+		lc.SetLimits(l)
+	}
+}
@@ -1,9 +1,11 @@
 package geerpc
 
 import (
+	"context"
+	"fmt"
 	"go/ast"
-	"log"
 	"reflect"
+	"runtime/debug"
 	"sync/atomic"
 )
 
@@ -11,13 +13,32 @@ import (
 // 抽象成一个methodType
 type methodType struct {
 	// 方法本身
-	method    reflect.Method
+	method reflect.Method
 	// 第一个参数
-	ArgType   reflect.Type
+	ArgType reflect.Type
 	// 第二个参数
 	ReplyType reflect.Type
 	// 调用次数
-	numCalls  uint64
+	numCalls uint64
+	// 方法panic的次数
+	numPanics uint64
+	// 是否为流方法：func (t *T) MethodName(stream *ServerStream) error
+	// 流方法没有ArgType和ReplyType
+	streaming bool
+	// 注册时被标记为幂等
+	idempotent bool
+	// 注册时配置的限流，nil表示不限制
+	limiter *limiter
+	// 允许调用的角色，空表示不限制
+	roles []string
+	// 第一个参数是context.Context：func (t *T) MethodName(ctx context.Context, argType T1, replyType *T2) error
+	withContext bool
+	// 通过ServiceDesc注册的方法，直接调用handler，不需要反射
+	newArgs  func() interface{}
+	newReply func() interface{}
+	handler  func(srv interface{}, ctx context.Context, args interface{}) (interface{}, error)
+	// 通过HandleFunc注册的函数，调用时没有接收者
+	fn reflect.Value
 }
 
 // NumCalls 记录该方法被调用的次数
@@ -25,7 +46,15 @@ func (m *methodType) NumCalls() uint64 {
 	return atomic.LoadUint64(&m.numCalls)
 }
 
+// NumPanics 该方法panic的次数
+func (m *methodType) NumPanics() uint64 {
+	return atomic.LoadUint64(&m.numPanics)
+}
+
 func (m *methodType) newArgv() reflect.Value {
+	if m.newArgs != nil {
+		return reflect.ValueOf(m.newArgs())
+	}
 	var argv reflect.Value
 	// arg may be a pointer type, or a value type
 	if m.ArgType.Kind() == reflect.Ptr {
@@ -38,6 +67,10 @@ func (m *methodType) newArgv() reflect.Value {
 }
 
 func (m *methodType) newReplyv() reflect.Value {
+	if m.handler != nil {
+		// 响应由handler返回
+		return reflect.Value{}
+	}
 	// reply must be a pointer type
 	replyv := reflect.New(m.ReplyType.Elem())
 	switch m.ReplyType.Elem().Kind() {
@@ -49,73 +82,194 @@ func (m *methodType) newReplyv() reflect.Value {
 	return replyv
 }
 
-
 type service struct {
-	name   string
+	name string
 	// 所注册的rpc服务结构体类型
-	typ    reflect.Type
+	typ reflect.Type
 
 	// 所注册的rpc服务实例
-	rcvr   reflect.Value
+	rcvr reflect.Value
 	// rpc实例对外暴露的方法
 	method map[string]*methodType
+	// 服务端内置的服务，例如健康检查
+	builtin bool
+	// 通过ServiceDesc注册的服务的实现
+	impl interface{}
+	// 由HandleFunc注册的函数组成的服务，可以继续添加方法
+	funcs bool
 }
 
 // newService 将一个rpc服务，注册成service
-func newService(rcvr interface{}) *service {
+func newService(rcvr interface{}) (*service, error) {
 	s := new(service)
 	s.rcvr = reflect.ValueOf(rcvr)
 	s.name = reflect.Indirect(s.rcvr).Type().Name()
 	s.typ = reflect.TypeOf(rcvr)
 	if !ast.IsExported(s.name) {
 		// 所注册的rpc服务结构体，必须是包外可见的
-		log.Fatalf("rpc server: %s is not a valid service name", s.name)
+		return nil, fmt.Errorf("rpc server: %s is not a valid service name", s.name)
+	}
+	s.registerMethods()
+	return s, nil
+}
+
+// newBuiltinService 创建服务端内置的服务
+// 内置服务的名字以"_"开头，不会和用户注册的服务冲突
+func newBuiltinService(name string, rcvr interface{}) *service {
+	s := &service{
+		name:    name,
+		typ:     reflect.TypeOf(rcvr),
+		rcvr:    reflect.ValueOf(rcvr),
+		builtin: true,
 	}
 	s.registerMethods()
 	return s
 }
 
+// applyOption 把注册时的配置应用到每个方法上
+func (s *service) applyOption(opt *ServiceOption) error {
+	for name, mopt := range opt.Methods {
+		m := s.method[name]
+		if m == nil {
+			return fmt.Errorf("rpc: method %s.%s not found", s.name, name)
+		}
+		m.applyOption(mopt)
+	}
+	return nil
+}
+
+// applyOption 把对单个方法的配置应用到m上
+func (m *methodType) applyOption(mopt *MethodOption) {
+	if mopt != nil {
+		m.idempotent = mopt.Idempotent
+		m.limiter = newLimiter(mopt.Limit)
+		m.roles = mopt.Roles
+	}
+}
+
 // registerMethods 获取rpc服务结构体的方法，供客户端调用
 // 可供调用的条件：
 // 1、方法是包外可见的
 // 2、返回值只能有一个，且必须是error类型
 // 3、必须是三个入参，第二、三个必须是包外可见的自定义类型，或者是内建类型
+// 4、也可以在参数前面多一个context.Context，用来获取对方的信息
 func (s *service) registerMethods() {
 	s.method = make(map[string]*methodType)
 	for i := 0; i < s.typ.NumMethod(); i++ {
 		method := s.typ.Method(i)
-		mType := method.Type
-		if mType.NumIn() != 3 || mType.NumOut() != 1 {
+		m := newMethodType(method.Type, 1)
+		if m == nil {
 			continue
 		}
+		m.method = method
+		s.method[method.Name] = m
+	}
+}
 
-		if mType.Out(0) != reflect.TypeOf((*error)(nil)).Elem() {
-			continue
-		}
-		argType, replyType := mType.In(1), mType.In(2)
-		if !isExportedOrBuiltinType(argType) || !isExportedOrBuiltinType(replyType) {
-			continue
-		}
-		s.method[method.Name] = &methodType{
-			method:    method,
-			ArgType:   argType,
-			ReplyType: replyType,
-		}
-		log.Printf("rpc server: register %s.%s\n", s.name, method.Name)
+// newMethodType 检查方法的签名，不能作为rpc方法时返回nil
+// recv是接收者占用的参数个数，结构体的方法为1，HandleFunc注册的函数为0
+func newMethodType(mType reflect.Type, recv int) *methodType {
+	if isStreamMethod(mType, recv) {
+		return &methodType{streaming: true}
+	}
+	withContext := mType.NumIn() == recv+3 && mType.In(recv) == typeOfContext
+	if (mType.NumIn() != recv+2 && !withContext) || mType.NumOut() != 1 {
+		return nil
+	}
+
+	if mType.Out(0) != typeOfError {
+		return nil
+	}
+	argType, replyType := mType.In(mType.NumIn()-2), mType.In(mType.NumIn()-1)
+	if !isExportedOrBuiltinType(argType) || !isExportedOrBuiltinType(replyType) {
+		return nil
 	}
+	return &methodType{
+		ArgType:     argType,
+		ReplyType:   replyType,
+		withContext: withContext,
+	}
+}
+
+var (
+	typeOfError        = reflect.TypeOf((*error)(nil)).Elem()
+	typeOfServerStream = reflect.TypeOf((*ServerStream)(nil))
+	typeOfContext      = reflect.TypeOf((*context.Context)(nil)).Elem()
+)
+
+// isStreamMethod 流方法只有一个*ServerStream参数，返回值只有一个error
+func isStreamMethod(mType reflect.Type, recv int) bool {
+	return mType.NumIn() == recv+1 && mType.In(recv) == typeOfServerStream &&
+		mType.NumOut() == 1 && mType.Out(0) == typeOfError
 }
 
 func isExportedOrBuiltinType(t reflect.Type) bool {
 	return ast.IsExported(t.Name()) || t.PkgPath() == ""
 }
 
-func (s *service) call(m *methodType, argv, replyv reflect.Value) error {
+// call 调用服务方法，返回要发送给客户端的响应
+func (s *service) call(ctx context.Context, m *methodType, argv, replyv reflect.Value) (reply interface{}, err error) {
 	atomic.AddUint64(&m.numCalls, 1)
+	defer s.recover(m, &err)
+	if m.handler != nil {
+		reply, err = m.handler(s.impl, ctx, argv.Interface())
+		if err == nil && reply == nil {
+			reply = m.newReply()
+		}
+		return reply, err
+	}
 	f := m.method.Func
 	// Call方法的参数数组，第一个元素必须是方法所属的实例本身
-	returnValues := f.Call([]reflect.Value{s.rcvr, argv, replyv})
+	in := []reflect.Value{s.rcvr, argv, replyv}
+	if m.withContext {
+		in = []reflect.Value{s.rcvr, reflect.ValueOf(ctx), argv, replyv}
+	}
+	if m.fn.IsValid() {
+		// 函数没有接收者
+		f, in = m.fn, in[1:]
+	}
+	returnValues := f.Call(in)
+	if errInter := returnValues[0].Interface(); errInter != nil {
+		return nil, errInter.(error)
+	}
+	return replyv.Interface(), nil
+}
+
+// callStream 调用流方法，流的生命周期由方法本身决定
+func (s *service) callStream(m *methodType, ss *ServerStream) (err error) {
+	atomic.AddUint64(&m.numCalls, 1)
+	defer s.recover(m, &err)
+	f, in := m.method.Func, []reflect.Value{s.rcvr, reflect.ValueOf(ss)}
+	if m.fn.IsValid() {
+		f, in = m.fn, in[1:]
+	}
+	returnValues := f.Call(in)
 	if errInter := returnValues[0].Interface(); errInter != nil {
 		return errInter.(error)
 	}
 	return nil
-}
\ No newline at end of file
+}
+
+// panicError 服务方法panic时代替返回的错误
+type panicError struct {
+	serviceMethod string
+	value         interface{}
+	stack         []byte
+}
+
+func (e *panicError) Error() string {
+	return fmt.Sprintf("rpc server: panic in %s: %v", e.serviceMethod, e.value)
+}
+
+// recover 服务方法panic时记录次数，并把panic转换成*panicError，
+// 只影响这一次调用，连接和其他调用不受影响
+func (s *service) recover(m *methodType, err *error) {
+	if r := recover(); r != nil {
+		atomic.AddUint64(&m.numPanics, 1)
+		*err = &panicError{
+			serviceMethod: s.name + "." + m.method.Name,
+			value:         r,
+			stack:         debug.Stack(),
+		}
+	}
+}
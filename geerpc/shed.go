@@ -0,0 +1,107 @@
+package geerpc
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// ShedOption 自适应降载的配置
+//
+// 服务端根据处理延迟动态调整同时处理的请求数上限（gradient算法）：
+// 最近的延迟明显高于长期的延迟时，说明请求开始排队，按比例降低上限；
+// 延迟正常时逐渐放大上限。超过上限的请求在读取body之前就被拒绝，
+// 响应头中会带上建议的重试等待时间
+type ShedOption struct {
+	InitialLimit int     // 初始的并发上限，默认20
+	MinLimit     int     // 并发上限的下限，默认4
+	MaxLimit     int     // 并发上限的上限，默认1000
+	Tolerance    float64 // 最近延迟超过长期延迟多少倍才开始降低上限，默认2
+	Smoothing    float64 // 每次调整的平滑系数，取值0~1，默认0.2
+}
+
+// adaptiveLimiter gradient算法实现的并发上限
+type adaptiveLimiter struct {
+	opt ShedOption
+
+	mu       sync.Mutex // protect following
+	limit    float64
+	inflight int
+	shortRTT float64 // 最近的平均延迟，单位纳秒
+	longRTT  float64 // 长期的平均延迟，单位纳秒
+}
+
+func newAdaptiveLimiter(opt *ShedOption) *adaptiveLimiter {
+	if opt == nil {
+		return nil
+	}
+	o := *opt
+	if o.MinLimit <= 0 {
+		o.MinLimit = 4
+	}
+	if o.MaxLimit <= 0 {
+		o.MaxLimit = 1000
+	}
+	if o.InitialLimit <= 0 {
+		o.InitialLimit = 20
+	}
+	if o.Tolerance <= 0 {
+		o.Tolerance = 2
+	}
+	if o.Smoothing <= 0 || o.Smoothing > 1 {
+		o.Smoothing = 0.2
+	}
+	return &adaptiveLimiter{opt: o, limit: float64(o.InitialLimit)}
+}
+
+// acquire 判断是否放行一个请求
+// 拒绝时返回建议客户端等待的时间
+func (a *adaptiveLimiter) acquire() (time.Duration, bool) {
+	if a == nil {
+		return 0, true
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.inflight >= int(a.limit) {
+		// 大约一个请求的处理时间之后就会有空闲的名额
+		retryAfter := time.Duration(a.shortRTT)
+		if retryAfter < time.Millisecond {
+			retryAfter = time.Millisecond
+		}
+		return retryAfter, false
+	}
+	a.inflight++
+	return 0, true
+}
+
+// release 请求处理完毕，rtt为这次请求的处理时间
+func (a *adaptiveLimiter) release(rtt time.Duration) {
+	if a == nil {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	inflight := a.inflight
+	a.inflight--
+
+	sample := float64(rtt)
+	if a.longRTT == 0 {
+		a.shortRTT, a.longRTT = sample, sample
+		return
+	}
+	a.shortRTT = a.shortRTT*0.9 + sample*0.1
+	a.longRTT = a.longRTT*0.99 + sample*0.01
+	if a.longRTT > a.shortRTT {
+		// 延迟恢复后长期延迟也要尽快跟上，否则之后会一直放大上限
+		a.longRTT = a.shortRTT
+	}
+
+	gradient := math.Max(0.5, math.Min(1, a.opt.Tolerance*a.longRTT/a.shortRTT))
+	newLimit := a.limit*gradient + math.Sqrt(a.limit)
+	if newLimit > a.limit && float64(inflight) < a.limit/2 {
+		// 请求不多时不需要放大上限，避免空闲时上限无限增长
+		return
+	}
+	a.limit = a.limit*(1-a.opt.Smoothing) + newLimit*a.opt.Smoothing
+	a.limit = math.Max(float64(a.opt.MinLimit), math.Min(float64(a.opt.MaxLimit), a.limit))
+}
@@ -0,0 +1,104 @@
+package geerpc
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// numDecodes 记录CountedArgs被解码的次数
+var numDecodes int32
+
+// CountedArgs 每次被解码时计数，用来确认被拒绝的请求没有读取参数
+type CountedArgs struct{}
+
+func (CountedArgs) GobEncode() ([]byte, error) { return []byte{1}, nil }
+
+func (*CountedArgs) GobDecode([]byte) error {
+	atomic.AddInt32(&numDecodes, 1)
+	return nil
+}
+
+func TestShed(t *testing.T) {
+	server := NewServer(&ServerOption{Shed: &ShedOption{InitialLimit: 1, MinLimit: 1, MaxLimit: 1}})
+	started := make(chan struct{}, 10)
+	if err := server.HandleFunc("Shed.Sleep", func(ms int, reply *int) error {
+		started <- struct{}{}
+		time.Sleep(time.Duration(ms) * time.Millisecond)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.HandleFunc("Shed.Count", func(args *CountedArgs, reply *int) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	addr := startServer(t, server)
+	client := dialTest(t, addr)
+
+	// 第一次调用的处理时间作为之后建议的重试等待时间
+	var reply int
+	if err := client.Call("Shed.Sleep", 100, &reply); err != nil {
+		t.Fatal(err)
+	}
+	<-started
+	call := client.Go("Shed.Sleep", 60, new(int), nil)
+	<-started
+
+	atomic.StoreInt32(&numDecodes, 0)
+	err := client.Call("Shed.Count", CountedArgs{}, &reply)
+	var e *Error
+	if !errors.As(err, &e) || e.Code != CodeUnavailable {
+		t.Fatalf("shed call err = %v, want Unavailable", err)
+	}
+	if e.RetryAfter < 50*time.Millisecond {
+		t.Fatalf("RetryAfter = %v, want about the 100ms handling time", e.RetryAfter)
+	}
+	// 被拒绝的请求在读取body之前就返回了
+	if n := atomic.LoadInt32(&numDecodes); n != 0 {
+		t.Fatalf("shed request body decoded %d times", n)
+	}
+
+	// 服务端在执行之前拒绝的请求，即使不是幂等的也可以重试，并且至少等待RetryAfter
+	retrying := dialTest(t, addr, &Option{Retry: &RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Millisecond}})
+	start := time.Now()
+	if err := retrying.Call("Shed.Count", CountedArgs{}, &reply); err != nil {
+		t.Fatalf("retried call err = %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < e.RetryAfter-10*time.Millisecond {
+		t.Fatalf("retried after %v, want at least RetryAfter %v", elapsed, e.RetryAfter)
+	}
+	if n := atomic.LoadInt32(&numDecodes); n != 1 {
+		t.Fatalf("body decoded %d times, want only the accepted attempt", n)
+	}
+	if err := (<-call.Done).Error; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAdaptiveLimiterGradient(t *testing.T) {
+	a := newAdaptiveLimiter(&ShedOption{InitialLimit: 50, MinLimit: 4})
+	// 请求不多时上限不会增长
+	for i := 0; i < 200; i++ {
+		a.acquire()
+		a.release(time.Millisecond)
+	}
+	if a.limit != 50 {
+		t.Fatalf("limit = %.1f after idle traffic, want 50", a.limit)
+	}
+	// 延迟突然变成原来的10倍，说明请求在排队，上限应该降低
+	for i := 0; i < 50; i++ {
+		if _, ok := a.acquire(); !ok {
+			t.Fatalf("acquire %d rejected below the limit", i)
+		}
+	}
+	if _, ok := a.acquire(); ok {
+		t.Fatal("acquire over the limit succeeded")
+	}
+	for i := 0; i < 30; i++ {
+		a.release(10 * time.Millisecond)
+	}
+	if a.limit >= 50 {
+		t.Fatalf("limit %.1f did not drop when latency jumped", a.limit)
+	}
+}
@@ -0,0 +1,133 @@
+package geerpc
+
+import (
+	"context"
+	"geerpc/codec"
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+// Shutdown 优雅地关闭服务端
+//
+// 先关闭所有的监听，不再接受新的连接；然后给每个连接发送FrameGoAway，
+// 告诉客户端不要再发送新的请求。已经收到的请求和流会继续处理，
+// 连接上的调用和流都结束后，客户端会主动断开；忽略FrameGoAway的对端，
+// 服务端等待drainGrace后关闭连接。
+// 所有连接都断开后返回nil；ctx结束时强制关闭剩下的连接，返回ctx.Err()
+func (server *Server) Shutdown(ctx context.Context) error {
+	server.mu.Lock()
+	server.shutdown = true
+	for lis := range server.listeners {
+		_ = lis.Close()
+	}
+	for sc := range server.conns {
+		// 客户端不读取时写入可能阻塞，不能卡住关闭的流程
+		go sc.drain()
+	}
+	server.mu.Unlock()
+
+	// 和net/http一样轮询，间隔逐渐变长
+	interval := time.Millisecond
+	timer := time.NewTimer(interval)
+	defer timer.Stop()
+	for {
+		if server.numConns() == 0 {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			server.mu.Lock()
+			for sc := range server.conns {
+				_ = sc.cc.Close()
+			}
+			server.mu.Unlock()
+			return ctx.Err()
+		case <-timer.C:
+		}
+		if interval < 500*time.Millisecond {
+			interval *= 2
+		}
+		timer.Reset(interval)
+	}
+}
+
+// goAway 通知客户端服务端即将关闭
+func (sc *serverConn) goAway() {
+	_ = sc.write(&codec.Header{Frame: codec.FrameGoAway}, emptyBody)
+}
+
+// drainGrace 连接上的调用和流都结束后，再等待这么长时间才关闭连接
+// 客户端可能在收到FrameGoAway之前已经发出了请求，立即关闭会让这些请求失败，
+// 而客户端会认为请求已经发出，不能安全地重试。正常的客户端处理完GoAway后会主动断开，
+// 这段时间只对忽略FrameGoAway的对端有影响
+const drainGrace = time.Second
+
+// drain 通知客户端服务端即将关闭，连接上的调用和流都结束后由服务端关闭连接
+// 不依赖客户端主动断开，忽略FrameGoAway的对端也不会让Shutdown一直等到超时
+func (sc *serverConn) drain() {
+	sc.goAway()
+	atomic.StoreInt32(&sc.draining, 1)
+	sc.closeIfDrained()
+}
+
+// closeIfDrained 连接正在关闭，并且没有正在处理的调用和流时，等待drainGrace后关闭连接
+// 在此期间继续读取和处理路上的请求，有新的调用时等它们结束后重新计时
+func (sc *serverConn) closeIfDrained() {
+	if atomic.LoadInt32(&sc.draining) == 0 || atomic.LoadInt32(&sc.active) > 0 {
+		return
+	}
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	if sc.drainTimer == nil {
+		sc.drainTimer = time.AfterFunc(drainGrace, func() {
+			if atomic.LoadInt32(&sc.active) == 0 {
+				_ = sc.cc.Close()
+			}
+		})
+		return
+	}
+	sc.drainTimer.Reset(drainGrace)
+}
+
+func (server *Server) shuttingDown() bool {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	return server.shutdown
+}
+
+// trackListener 记录或者移除正在监听的listener，服务端已经关闭时返回false
+func (server *Server) trackListener(lis net.Listener, add bool) bool {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if !add {
+		delete(server.listeners, lis)
+		return true
+	}
+	if server.shutdown {
+		return false
+	}
+	server.listeners[lis] = struct{}{}
+	return true
+}
+
+// trackConn 记录或者移除正在服务的连接，服务端已经关闭时返回false
+func (server *Server) trackConn(sc *serverConn, add bool) bool {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if !add {
+		delete(server.conns, sc)
+		return true
+	}
+	if server.shutdown {
+		return false
+	}
+	server.conns[sc] = struct{}{}
+	return true
+}
+
+func (server *Server) numConns() int {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	return len(server.conns)
+}
@@ -0,0 +1,201 @@
+package geerpc
+
+import (
+	"context"
+	"encoding/json"
+	"geerpc/codec"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// dialRaw 只完成握手的连接，不理会FrameGoAway，也不会主动断开
+func dialRaw(t *testing.T, addr string) (net.Conn, codec.Codec) {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	if err := json.NewEncoder(conn).Encode(DefaultOption); err != nil {
+		t.Fatal(err)
+	}
+	return conn, codec.NewGobCodec(conn)
+}
+
+func shutdownAsync(server *Server) chan error {
+	done := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		done <- server.Shutdown(ctx)
+	}()
+	return done
+}
+
+// TestShutdownIgnoringPeer 对端忽略FrameGoAway时，服务端在调用结束后自己关闭连接
+func TestShutdownIgnoringPeer(t *testing.T) {
+	server := NewServer()
+	started, release := make(chan struct{}, 1), make(chan struct{})
+	if err := server.HandleFunc("Block.Wait", func(n int, reply *int) error {
+		started <- struct{}{}
+		<-release
+		*reply = n
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	addr := startServer(t, server)
+	dialRaw(t, addr) // 空闲的连接
+	_, cc := dialRaw(t, addr)
+	if err := cc.Write(&codec.Header{ServiceMethod: "Block.Wait", Seq: 1}, 42); err != nil {
+		t.Fatal(err)
+	}
+	waitStarted(t, started)
+
+	done := shutdownAsync(server)
+	select {
+	case err := <-done:
+		t.Fatalf("Shutdown returned %v with a call in flight", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+	close(release)
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Shutdown err = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Shutdown waited for peers that ignore FrameGoAway")
+	}
+
+	// 对端先收到FrameGoAway，然后是调用的响应，最后连接被关闭
+	var h codec.Header
+	var frames []codec.FrameType
+	for cc.ReadHeader(&h) == nil {
+		frames = append(frames, h.Frame)
+		var reply int
+		if h.Frame == codec.FrameCall {
+			if err := cc.ReadBody(&reply); err != nil || reply != 42 || h.Error != "" {
+				t.Fatalf("response = %d, %q, %v", reply, h.Error, err)
+			}
+		} else {
+			_ = cc.ReadBody(nil)
+		}
+		h = codec.Header{}
+	}
+	if len(frames) != 2 || frames[0] != codec.FrameGoAway || frames[1] != codec.FrameCall {
+		t.Fatalf("frames = %v, want GoAway then the response", frames)
+	}
+}
+
+// TestShutdownOpenStream 服务端关闭时已经打开的流可以继续收发，直到流正常结束
+func TestShutdownOpenStream(t *testing.T) {
+	server := NewServer()
+	client := dialTest(t, startServer(t, server, new(Calc)))
+	cs, err := client.NewStream("Calc.Double")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var reply int
+	if err := cs.Send(1); err != nil {
+		t.Fatal(err)
+	}
+	if err := cs.Recv(&reply); err != nil || reply != 2 {
+		t.Fatalf("reply = %d, %v", reply, err)
+	}
+
+	done := shutdownAsync(server)
+	deadline := time.Now().Add(5 * time.Second)
+	for !client.isDraining() {
+		if time.Now().After(deadline) {
+			t.Fatal("client never received FrameGoAway")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if _, err := client.NewStream("Calc.Double"); err != ErrGoingAway {
+		t.Fatalf("NewStream err = %v, want ErrGoingAway", err)
+	}
+
+	// 消息数超过流控窗口，双方都要在收到FrameGoAway之后归还窗口
+	const n = 4 * streamWindow
+	sendErr := make(chan error, 1)
+	go func() {
+		for i := 0; i < n; i++ {
+			if err := cs.Send(i); err != nil {
+				sendErr <- err
+				return
+			}
+		}
+		sendErr <- cs.CloseSend()
+	}()
+	for i := 0; i < n; i++ {
+		if err := cs.Recv(&reply); err != nil || reply != 2*i {
+			t.Fatalf("reply %d = %d, %v", i, reply, err)
+		}
+	}
+	if err := <-sendErr; err != nil {
+		t.Fatalf("send after GoAway: %v", err)
+	}
+	if err := cs.Recv(&reply); err != io.EOF {
+		t.Fatalf("Recv err = %v, want io.EOF", err)
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Shutdown err = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Shutdown did not return after the stream ended")
+	}
+}
+
+// readGoAway 读取对端收到的下一帧，要求是FrameGoAway
+func readGoAway(t *testing.T, cc codec.Codec) {
+	t.Helper()
+	var h codec.Header
+	if err := cc.ReadHeader(&h); err != nil || h.Frame != codec.FrameGoAway {
+		t.Fatalf("expect FrameGoAway, got %v %v", h.Frame, err)
+	}
+	_ = cc.ReadBody(nil)
+}
+
+// rawSum 在原始连接上调用Calc.Sum并检查结果
+func rawSum(t *testing.T, cc codec.Codec, seq uint64) {
+	t.Helper()
+	if err := cc.Write(&codec.Header{ServiceMethod: "Calc.Sum", Seq: seq}, CalcArgs{Num1: 1, Num2: 2}); err != nil {
+		t.Fatal(err)
+	}
+	var h codec.Header
+	var reply int
+	if err := cc.ReadHeader(&h); err != nil || h.Error != "" || h.Seq != seq {
+		t.Fatalf("response header %+v, %v", h, err)
+	}
+	if err := cc.ReadBody(&reply); err != nil || reply != 3 {
+		t.Fatalf("reply = %d, %v", reply, err)
+	}
+}
+
+// callAfterGoAway 模拟客户端收到FrameGoAway之前已经发出的请求，服务端仍然要正常处理
+func callAfterGoAway(t *testing.T, cc codec.Codec) {
+	t.Helper()
+	rawSum(t, cc, 2)
+	// 对端一直不断开，服务端等待一段时间后关闭连接
+	var h codec.Header
+	if err := cc.ReadHeader(&h); err == nil {
+		t.Fatalf("expect the connection to be closed, got %+v", h)
+	}
+}
+
+func TestShutdownRequestInFlight(t *testing.T) {
+	server := NewServer()
+	_, cc := dialRaw(t, startServer(t, server, new(Calc)))
+	// 确保服务端已经开始服务这个连接
+	rawSum(t, cc, 1)
+	done := shutdownAsync(server)
+	readGoAway(t, cc)
+	callAfterGoAway(t, cc)
+	if err := <-done; err != nil {
+		t.Fatalf("Shutdown err = %v", err)
+	}
+}
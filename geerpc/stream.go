@@ -0,0 +1,308 @@
+package geerpc
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"geerpc/codec"
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+// streamWindow 每个流的流控窗口大小
+// 接收方最多缓存这么多条还没被读取的消息，发送方在收到窗口更新前最多发送这么多条，
+// 所以一个发送很快的流只会用完自己的窗口，不会占满连接上的缓存把其他流饿死
+const streamWindow = 32
+
+var (
+	// ErrStreamReset 对方放弃了这个流
+	ErrStreamReset = errors.New("stream reset by peer")
+	// ErrStreamClosed 本方已经关闭了这个流
+	ErrStreamClosed = errors.New("stream is closed")
+
+	errFlowControl = errors.New("stream flow control violated")
+)
+
+// emptyBody 控制帧没有内容，用它占位
+var emptyBody = struct{}{}
+
+// maxPooledBuffer 超过这个大小的缓冲区不放回池中，避免一条大消息之后一直占用内存
+const maxPooledBuffer = 64 << 10
+
+// bufferPool 复用编码流消息的缓冲区
+var bufferPool = sync.Pool{New: func() interface{} { return new(bytes.Buffer) }}
+
+// stream 是客户端流和服务端流共用的部分：
+// 缓存收到的消息、维护发送窗口，并在消息被读取后向对方归还窗口
+type stream struct {
+	seq       uint64
+	codecType codec.Type
+	// 发送一帧报文，由客户端或服务端提供，需要保证报文完整发送
+	write func(h *codec.Header, body interface{}) error
+
+	mu         sync.Mutex
+	cond       *sync.Cond
+	queue      [][]byte // 已经收到但还没被读取的消息
+	consumed   uint32   // 上次归还窗口之后读取的消息数
+	sendWindow uint32   // 还可以发送的消息数
+	sendClosed bool     // 本方不再发送
+	recvClosed bool     // 对方不再发送
+	recvErr    error    // 对方结束发送的原因，nil表示正常结束
+	err        error    // 流被终止的原因
+}
+
+func newStream(seq uint64, ct codec.Type, write func(*codec.Header, interface{}) error) *stream {
+	st := &stream{
+		seq:        seq,
+		codecType:  ct,
+		write:      write,
+		sendWindow: streamWindow,
+	}
+	st.cond = sync.NewCond(&st.mu)
+	return st
+}
+
+// send 编码并发送一条消息
+// 发送窗口用完时阻塞，直到对方读取了消息并归还窗口
+func (st *stream) send(v interface{}) error {
+	buf := bufferPool.Get().(*bytes.Buffer)
+	defer func() {
+		if buf.Cap() <= maxPooledBuffer {
+			buf.Reset()
+			bufferPool.Put(buf)
+		}
+	}()
+	if err := codec.MarshalTo(st.codecType, buf, v); err != nil {
+		return err
+	}
+	var err error
+	st.mu.Lock()
+	for st.sendWindow == 0 && st.err == nil && !st.sendClosed {
+		st.cond.Wait()
+	}
+	switch {
+	case st.err != nil:
+		err = st.err
+	case st.sendClosed:
+		err = ErrStreamClosed
+	default:
+		st.sendWindow--
+	}
+	st.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	// write返回时消息已经编码到连接的缓冲区中，buf可以复用
+	return st.write(&codec.Header{Seq: st.seq, Frame: codec.FrameStreamData}, buf.Bytes())
+}
+
+// recv 读取一条消息到v中
+// 对方正常结束发送并且消息都读完后返回io.EOF
+func (st *stream) recv(v interface{}) error {
+	st.mu.Lock()
+	for len(st.queue) == 0 && !st.recvClosed && st.err == nil {
+		st.cond.Wait()
+	}
+	if len(st.queue) == 0 {
+		err := st.err
+		if st.recvClosed {
+			err = st.recvErr
+			if err == nil {
+				err = io.EOF
+			}
+		}
+		st.mu.Unlock()
+		return err
+	}
+	data := st.queue[0]
+	st.queue[0] = nil
+	st.queue = st.queue[1:]
+
+	// 读取了一半窗口的消息后再归还，避免每读一条就发一帧窗口更新
+	var grant uint32
+	st.consumed++
+	if st.consumed >= streamWindow/2 && !st.recvClosed && st.err == nil {
+		grant, st.consumed = st.consumed, 0
+	}
+	st.mu.Unlock()
+
+	if grant > 0 {
+		_ = st.write(&codec.Header{Seq: st.seq, Frame: codec.FrameWindow, Window: grant}, emptyBody)
+	}
+	return codec.Unmarshal(st.codecType, data, v)
+}
+
+// deliver 由读取报文的协程调用，缓存收到的一条消息
+// 对方不遵守流控，发送超过窗口的消息时返回错误
+func (st *stream) deliver(data []byte) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.err != nil || st.recvClosed {
+		// 流已经结束，直接丢弃
+		return nil
+	}
+	if len(st.queue) >= streamWindow {
+		return errFlowControl
+	}
+	st.queue = append(st.queue, data)
+	st.cond.Broadcast()
+	return nil
+}
+
+// addWindow 对方归还了n条消息的发送窗口
+func (st *stream) addWindow(n uint32) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.sendWindow += n
+	st.cond.Broadcast()
+}
+
+// closeRecv 对方不再发送消息，err为对方给出的结束原因
+func (st *stream) closeRecv(err error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.recvClosed = true
+	st.recvErr = err
+	st.cond.Broadcast()
+}
+
+// closeSend 本方不再发送消息，返回之前是否已经关闭过
+func (st *stream) closeSend() bool {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	closed := st.sendClosed
+	st.sendClosed = true
+	st.cond.Broadcast()
+	return closed
+}
+
+// fail 终止这个流，阻塞中的send和recv都会返回err
+func (st *stream) fail(err error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.err == nil {
+		st.err = err
+	}
+	st.cond.Broadcast()
+}
+
+// ClientStream 客户端一侧的流，通过Client.NewStream创建
+//
+// 客户端流：多次Send后调用CloseAndRecv获取服务端唯一的响应
+// 双向流：Send和Recv可以在不同的协程中同时调用
+type ClientStream struct {
+	st            *stream
+	client        *Client
+	ServiceMethod string
+
+	observe func(err error) // 流结束时记录指标，可能为nil
+	span    Span            // 客户端的span，没有配置Tracer时为nil
+	ended   sync.Once
+}
+
+// end 流以err结束，只有第一次调用有效
+func (cs *ClientStream) end(err error) {
+	cs.ended.Do(func() {
+		if cs.observe != nil {
+			cs.observe(err)
+		}
+		if cs.span != nil {
+			endSpan(cs.span, cs.st.seq, err)
+		}
+	})
+}
+
+// Send 发送一条消息
+// 服务端已经结束这个流时返回io.EOF，结束的原因可以通过Recv获取
+func (cs *ClientStream) Send(v interface{}) error {
+	return cs.st.send(v)
+}
+
+// Recv 读取服务端发送的一条消息
+// 服务端正常结束时返回io.EOF，否则返回服务端方法的错误
+func (cs *ClientStream) Recv(v interface{}) error {
+	return cs.st.recv(v)
+}
+
+// CloseSend 告诉服务端客户端不再发送消息，之后仍然可以Recv
+func (cs *ClientStream) CloseSend() error {
+	if cs.st.closeSend() {
+		return nil
+	}
+	return cs.st.write(&codec.Header{Seq: cs.st.seq, Frame: codec.FrameStreamEnd}, emptyBody)
+}
+
+// CloseAndRecv 用于客户端流：关闭发送并等待服务端唯一的响应
+func (cs *ClientStream) CloseAndRecv(reply interface{}) error {
+	if err := cs.CloseSend(); err != nil {
+		return err
+	}
+	if err := cs.Recv(reply); err != nil {
+		if err == io.EOF {
+			return errors.New("rpc client: stream ended without a reply")
+		}
+		return err
+	}
+	return nil
+}
+
+// Close 放弃这个流，服务端的Recv和Send会返回ErrStreamReset
+func (cs *ClientStream) Close() error {
+	cs.st.fail(ErrStreamClosed)
+	if cs.client.removeStream(cs.st.seq) == nil {
+		// 流已经结束
+		return nil
+	}
+	cs.end(context.Canceled)
+	return cs.st.write(&codec.Header{Seq: cs.st.seq, Frame: codec.FrameStreamReset}, emptyBody)
+}
+
+// finish 服务端结束了这个流，err为服务端方法返回的错误
+func (cs *ClientStream) finish(err error) {
+	cs.st.closeRecv(err)
+	cs.st.fail(io.EOF)
+	cs.end(err)
+}
+
+// ServerStream 服务端一侧的流，是流方法唯一的参数
+// 流方法的签名为：func (t *T) MethodName(stream *geerpc.ServerStream) error
+// 方法返回后流随之结束，返回的错误会发送给客户端
+type ServerStream struct {
+	// 打开流和数据帧的字节数，以及发给客户端的所有帧的字节数，用于访问日志
+	reqSize  int64
+	respSize int64
+
+	st            *stream
+	ctx           context.Context
+	ServiceMethod string
+}
+
+// writeTo 返回通过sc发送这个流的报文的函数，同时统计发送的字节数
+func (ss *ServerStream) writeTo(sc *serverConn) func(*codec.Header, interface{}) error {
+	return func(h *codec.Header, body interface{}) error {
+		n, err := sc.writeN(h, body)
+		atomic.AddInt64(&ss.respSize, int64(n))
+		return err
+	}
+}
+
+// sizes 流上收到和发送的字节数
+func (ss *ServerStream) sizes() (int, int) {
+	return int(atomic.LoadInt64(&ss.reqSize)), int(atomic.LoadInt64(&ss.respSize))
+}
+
+// Context 返回这个流所在连接的ctx，可以通过PeerFromContext获取对方的信息
+func (ss *ServerStream) Context() context.Context {
+	return ss.ctx
+}
+
+// Recv 读取客户端发送的一条消息，客户端调用CloseSend后返回io.EOF
+func (ss *ServerStream) Recv(v interface{}) error {
+	return ss.st.recv(v)
+}
+
+// Send 向客户端发送一条消息
+func (ss *ServerStream) Send(v interface{}) error {
+	return ss.st.send(v)
+}
@@ -0,0 +1,181 @@
+package geerpc
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+type Calc int
+
+type CalcArgs struct{ Num1, Num2 int }
+
+func (c *Calc) Sum(args CalcArgs, reply *int) error {
+	*reply = args.Num1 + args.Num2
+	return nil
+}
+
+// SumAll 客户端流：返回客户端发送的所有数字的和
+func (c *Calc) SumAll(stream *ServerStream) error {
+	var sum int
+	for {
+		var num int
+		if err := stream.Recv(&num); err == io.EOF {
+			return stream.Send(sum)
+		} else if err != nil {
+			return err
+		}
+		sum += num
+	}
+}
+
+// Double 双向流：每收到一个数字就返回它的两倍
+func (c *Calc) Double(stream *ServerStream) error {
+	for {
+		var num int
+		if err := stream.Recv(&num); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if err := stream.Send(num * 2); err != nil {
+			return err
+		}
+	}
+}
+
+// startServer 启动一个监听随机端口的服务端，返回监听地址
+func startServer(t testing.TB, server *Server, rcvrs ...interface{}) string {
+	t.Helper()
+	for _, rcvr := range rcvrs {
+		if err := server.Register(rcvr); err != nil {
+			t.Fatal(err)
+		}
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = l.Close() })
+	go server.Accept(l)
+	return l.Addr().String()
+}
+
+func dialTest(t testing.TB, addr string, opts ...*Option) *Client {
+	t.Helper()
+	client, err := Dial("tcp", addr, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = client.Close() })
+	return client
+}
+
+func TestClientStream(t *testing.T) {
+	client := dialTest(t, startServer(t, NewServer(), new(Calc)))
+
+	stream, err := client.NewStream("Calc.SumAll")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 发送的消息数超过流控窗口，需要服务端归还窗口才能发完
+	for i := 1; i <= 10*streamWindow; i++ {
+		if err := stream.Send(i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var sum int
+	if err := stream.CloseAndRecv(&sum); err != nil {
+		t.Fatal(err)
+	}
+	n := 10 * streamWindow
+	if sum != n*(n+1)/2 {
+		t.Fatalf("expect %d, got %d", n*(n+1)/2, sum)
+	}
+}
+
+func TestBidiStream(t *testing.T) {
+	client := dialTest(t, startServer(t, NewServer(), new(Calc)))
+
+	stream, err := client.NewStream("Calc.Double")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for i := 0; i < 100; i++ {
+			_ = stream.Send(i)
+		}
+		_ = stream.CloseSend()
+	}()
+	for i := 0; i < 100; i++ {
+		var num int
+		if err := stream.Recv(&num); err != nil {
+			t.Fatal(err)
+		}
+		if num != i*2 {
+			t.Fatalf("expect %d, got %d", i*2, num)
+		}
+	}
+	var num int
+	if err := stream.Recv(&num); err != io.EOF {
+		t.Fatalf("expect io.EOF, got %v", err)
+	}
+}
+
+func TestStreamFlowControl(t *testing.T) {
+	client := dialTest(t, startServer(t, NewServer(), new(Calc)))
+
+	// 一个流的接收方不读取消息，发送方用完窗口后阻塞
+	slow, err := client.NewStream("Calc.Double")
+	if err != nil {
+		t.Fatal(err)
+	}
+	blocked := make(chan struct{})
+	go func() {
+		defer close(blocked)
+		for i := 0; ; i++ {
+			if err := slow.Send(i); err != nil {
+				return
+			}
+		}
+	}()
+
+	// 同一个连接上的其他调用不受影响
+	done := make(chan error, 1)
+	go func() {
+		var reply int
+		done <- client.Call("Calc.Sum", CalcArgs{Num1: 1, Num2: 2}, &reply)
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("call starved by a blocked stream")
+	}
+
+	_ = slow.Close()
+	select {
+	case <-blocked:
+	case <-time.After(time.Second):
+		t.Fatal("Send should return after Close")
+	}
+}
+
+func TestStreamErrors(t *testing.T) {
+	client := dialTest(t, startServer(t, NewServer(), new(Calc)))
+
+	stream, err := client.NewStream("Calc.Sum")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var reply int
+	if err := stream.Recv(&reply); err == nil || err == io.EOF {
+		t.Fatalf("expect error for non-streaming method, got %v", err)
+	}
+	if err := client.Call("Calc.SumAll", CalcArgs{}, &reply); err == nil {
+		t.Fatal("expect error when calling a streaming method")
+	}
+}
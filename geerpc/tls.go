@@ -0,0 +1,86 @@
+package geerpc
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+)
+
+// Peer 连接另一端的信息
+type Peer struct {
+	Addr net.Addr
+	// 使用TLS时握手后的状态，PeerCertificates中是对方的证书
+	TLS *tls.ConnectionState
+	// 服务端配置了Authenticator时，认证得到的调用方身份
+	Auth *AuthInfo
+}
+
+// Identity 返回对方证书中的身份：优先使用CommonName，没有时使用第一个DNS名称
+// 没有使用TLS或者对方没有提供证书时返回空字符串
+func (p *Peer) Identity() string {
+	if p.TLS == nil || len(p.TLS.PeerCertificates) == 0 {
+		return ""
+	}
+	cert := p.TLS.PeerCertificates[0]
+	if cert.Subject.CommonName != "" {
+		return cert.Subject.CommonName
+	}
+	if len(cert.DNSNames) > 0 {
+		return cert.DNSNames[0]
+	}
+	return ""
+}
+
+// remote 对方的地址，用于日志
+func (p *Peer) remote() string {
+	if p == nil || p.Addr == nil {
+		return ""
+	}
+	return p.Addr.String()
+}
+
+type peerKey struct{}
+
+func newPeerContext(ctx context.Context, p *Peer) context.Context {
+	return context.WithValue(ctx, peerKey{}, p)
+}
+
+// PeerFromContext 从服务方法收到的ctx中获取对方的信息
+func PeerFromContext(ctx context.Context) (*Peer, bool) {
+	p, ok := ctx.Value(peerKey{}).(*Peer)
+	return p, ok
+}
+
+// AcceptTLS 和Accept一样，但是连接都使用TLS
+// 需要校验客户端证书时，在config中设置ClientAuth和ClientCAs
+func (server *Server) AcceptTLS(lis net.Listener, config *tls.Config) {
+	server.Accept(tls.NewListener(lis, config))
+}
+
+// AcceptTLS accepts TLS connections on the listener for the DefaultServer.
+func AcceptTLS(lis net.Listener, config *tls.Config) { DefaultServer.AcceptTLS(lis, config) }
+
+// ServeTLS 从文件中加载证书和私钥，然后调用AcceptTLS
+func (server *Server) ServeTLS(lis net.Listener, certFile, keyFile string) error {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return err
+	}
+	server.AcceptTLS(lis, &tls.Config{Certificates: []tls.Certificate{cert}})
+	return nil
+}
+
+// DialTLS 使用TLS连接服务端，config会覆盖opts中的TLSConfig
+func DialTLS(network, address string, config *tls.Config, opts ...*Option) (*Client, error) {
+	if config == nil {
+		return nil, errors.New("rpc client: nil tls config")
+	}
+	opt, err := parseOptions(opts...)
+	if err != nil {
+		return nil, err
+	}
+	o := *opt
+	o.TLSConfig = config
+	return Dial(network, address, &o)
+}
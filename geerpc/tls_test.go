@@ -0,0 +1,165 @@
+package geerpc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+)
+
+// Whoami 返回调用方证书中的身份
+type Whoami struct{}
+
+func (Whoami) Identity(ctx context.Context, _ int, reply *string) error {
+	p, ok := PeerFromContext(ctx)
+	if !ok {
+		return Errorf(CodeInternal, "no peer in context")
+	}
+	*reply = p.Identity()
+	return nil
+}
+
+// testCA 测试时生成的自签名CA
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pool *x509.CertPool
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "geerpc test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return &testCA{cert: cert, key: key, pool: pool}
+}
+
+// issue 签发一个证书，server为true时用于服务端，否则用于客户端
+func (ca *testCA) issue(t *testing.T, cn string, server bool) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	if server {
+		tmpl.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+		tmpl.IPAddresses = []net.IP{net.ParseIP("127.0.0.1")}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func startTLSServer(t *testing.T, config *tls.Config) string {
+	t.Helper()
+	server := NewServer()
+	if err := server.Register(Whoami{}); err != nil {
+		t.Fatal(err)
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = l.Close() })
+	go server.AcceptTLS(l, config)
+	return l.Addr().String()
+}
+
+func TestTLS(t *testing.T) {
+	ca := newTestCA(t)
+	addr := startTLSServer(t, &tls.Config{
+		Certificates: []tls.Certificate{ca.issue(t, "server", true)},
+	})
+
+	client, err := DialTLS("tcp", addr, &tls.Config{RootCAs: ca.pool})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = client.Close() }()
+	var identity string
+	if err := client.Call("Whoami.Identity", 0, &identity); err != nil {
+		t.Fatal(err)
+	}
+	if identity != "" {
+		t.Fatalf("expect no client identity, got %q", identity)
+	}
+
+	// 不信任服务端证书的客户端无法建立连接
+	if _, err := DialTLS("tcp", addr, &tls.Config{}); err == nil {
+		t.Fatal("expect error when server certificate is not trusted")
+	}
+}
+
+func TestMutualTLS(t *testing.T) {
+	ca := newTestCA(t)
+	addr := startTLSServer(t, &tls.Config{
+		Certificates: []tls.Certificate{ca.issue(t, "server", true)},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    ca.pool,
+	})
+
+	client, err := Dial("tcp", addr, &Option{TLSConfig: &tls.Config{
+		RootCAs:      ca.pool,
+		Certificates: []tls.Certificate{ca.issue(t, "client-1", false)},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = client.Close() }()
+	var identity string
+	if err := client.Call("Whoami.Identity", 0, &identity); err != nil {
+		t.Fatal(err)
+	}
+	if identity != "client-1" {
+		t.Fatalf("expect identity client-1, got %q", identity)
+	}
+
+	// 没有客户端证书时，服务端拒绝握手
+	client, err = DialTLS("tcp", addr, &tls.Config{RootCAs: ca.pool})
+	if err == nil {
+		defer func() { _ = client.Close() }()
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		err = client.CallContext(ctx, "Whoami.Identity", 0, &identity)
+	}
+	if err == nil {
+		t.Fatal("expect error without client certificate")
+	}
+}
@@ -0,0 +1,153 @@
+package geerpc
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"geerpc/codec"
+	"strings"
+)
+
+// SpanKind span的类型
+type SpanKind int
+
+const (
+	SpanKindClient SpanKind = iota // 客户端发起的调用
+	SpanKindServer                 // 服务端处理的请求
+)
+
+func (k SpanKind) String() string {
+	if k == SpanKindServer {
+		return "server"
+	}
+	return "client"
+}
+
+// Tracer 链路追踪的钩子，客户端通过Option.Tracer配置，服务端通过ServerOption.Tracer配置
+//
+// 每次调用在客户端和服务端各有一个以ServiceMethod命名的span。
+// 客户端在发送请求前用Inject把追踪信息写入请求的元数据，服务端用Extract取出，
+// 所以接入OpenTelemetry时只需要把它的Tracer和TextMapPropagator包装成这个接口，
+// 核心代码不依赖OpenTelemetry。Recorder是一个记录在内存中的实现，可以用于测试
+type Tracer interface {
+	// Start 在ctx的基础上开始一个span，返回的ctx中带有这个span
+	Start(ctx context.Context, name string, kind SpanKind) (context.Context, Span)
+	// Inject 把ctx中的追踪信息写入请求的元数据，标准的做法是写入W3C的traceparent
+	Inject(ctx context.Context, md map[string]string)
+	// Extract 从请求的元数据中取出追踪信息，返回的ctx作为服务端span的父节点
+	Extract(ctx context.Context, md map[string]string) context.Context
+}
+
+// Span 一次调用在一端的记录
+type Span interface {
+	SetAttribute(key string, value interface{})
+	RecordError(err error)
+	End()
+}
+
+// span的属性名，尽量和OpenTelemetry的语义约定保持一致
+const (
+	AttrRPCSystem   = "rpc.system"
+	AttrRPCService  = "rpc.service"
+	AttrRPCMethod   = "rpc.method"
+	AttrSeq         = "rpc.geerpc.seq"
+	AttrCodec       = "rpc.geerpc.codec"
+	AttrCode        = "rpc.geerpc.code"
+	AttrPeerAddress = "network.peer.address"
+)
+
+// startSpan 开始一次调用的span并设置公共的属性
+func startSpan(ctx context.Context, t Tracer, serviceMethod string, kind SpanKind, ct string) (context.Context, Span) {
+	ctx, span := t.Start(ctx, serviceMethod, kind)
+	span.SetAttribute(AttrRPCSystem, "geerpc")
+	if dot := strings.LastIndex(serviceMethod, "."); dot >= 0 {
+		span.SetAttribute(AttrRPCService, serviceMethod[:dot])
+		span.SetAttribute(AttrRPCMethod, serviceMethod[dot+1:])
+	}
+	span.SetAttribute(AttrCodec, ct)
+	return ctx, span
+}
+
+// endSpan 记录调用的结果并结束span
+func endSpan(span Span, seq uint64, err error) {
+	span.SetAttribute(AttrSeq, seq)
+	span.SetAttribute(AttrCode, CodeOf(err).String())
+	if err != nil {
+		span.RecordError(err)
+	}
+	span.End()
+}
+
+// TraceParentKey W3C追踪信息在请求元数据中的key
+const TraceParentKey = "traceparent"
+
+// TraceContext W3C Trace Context中traceparent的内容
+type TraceContext struct {
+	TraceID [16]byte
+	SpanID  [8]byte
+	Flags   byte // 最低位表示是否采样
+}
+
+// IsValid TraceID和SpanID都不能全为0
+func (tc TraceContext) IsValid() bool {
+	return tc.TraceID != [16]byte{} && tc.SpanID != [8]byte{}
+}
+
+// String 按照traceparent的格式输出：version-traceid-spanid-flags
+func (tc TraceContext) String() string {
+	return "00-" + hex.EncodeToString(tc.TraceID[:]) + "-" +
+		hex.EncodeToString(tc.SpanID[:]) + "-" + hex.EncodeToString([]byte{tc.Flags})
+}
+
+var errInvalidTraceParent = errors.New("rpc: invalid traceparent")
+
+// ParseTraceParent 解析traceparent，只支持版本00
+func ParseTraceParent(s string) (TraceContext, error) {
+	var tc TraceContext
+	parts := strings.Split(s, "-")
+	if len(parts) != 4 || parts[0] != "00" || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return tc, errInvalidTraceParent
+	}
+	var flags [1]byte
+	if _, err := hex.Decode(tc.TraceID[:], []byte(parts[1])); err != nil {
+		return tc, errInvalidTraceParent
+	}
+	if _, err := hex.Decode(tc.SpanID[:], []byte(parts[2])); err != nil {
+		return tc, errInvalidTraceParent
+	}
+	if _, err := hex.Decode(flags[:], []byte(parts[3])); err != nil {
+		return tc, errInvalidTraceParent
+	}
+	tc.Flags = flags[0]
+	if !tc.IsValid() {
+		return tc, errInvalidTraceParent
+	}
+	return tc, nil
+}
+
+// newTraceID 和newSpanID生成随机的id
+func newTraceID() (id [16]byte) {
+	_, _ = rand.Read(id[:])
+	return
+}
+
+func newSpanID() (id [8]byte) {
+	_, _ = rand.Read(id[:])
+	return
+}
+
+// traceRequest 从请求头中取出追踪信息，开始服务端的span
+// 返回服务方法使用的ctx，以及在done之外还会结束span的函数
+func (server *Server) traceRequest(sc *serverConn, t Tracer, h *codec.Header, done func(error)) (context.Context, func(error)) {
+	ctx := t.Extract(sc.ctx, h.Meta)
+	ctx, span := startSpan(ctx, t, h.ServiceMethod, SpanKindServer, string(sc.opt.CodecType))
+	if sc.peer.Addr != nil {
+		span.SetAttribute(AttrPeerAddress, sc.peer.Addr.String())
+	}
+	seq := h.Seq
+	return ctx, func(err error) {
+		endSpan(span, seq, err)
+		done(err)
+	}
+}
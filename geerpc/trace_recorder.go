@@ -0,0 +1,112 @@
+package geerpc
+
+import (
+	"context"
+	"sync"
+)
+
+// Recorder 把span记录在内存中的Tracer，使用W3C traceparent传播追踪信息，一般用于测试
+type Recorder struct {
+	mu    sync.Mutex // protect following
+	spans []*recordedSpan
+}
+
+var _ Tracer = (*Recorder)(nil)
+
+// NewRecorder 创建一个空的Recorder
+func NewRecorder() *Recorder {
+	return &Recorder{}
+}
+
+// RecordedSpan Recorder记录的一个span
+type RecordedSpan struct {
+	Name         string
+	Kind         SpanKind
+	TraceContext TraceContext
+	Parent       TraceContext // 父节点，无效时表示这是trace的根节点
+	Attributes   map[string]interface{}
+	Errors       []error
+	Ended        bool
+}
+
+type recordedSpan struct {
+	r    *Recorder
+	span RecordedSpan
+}
+
+func (s *recordedSpan) SetAttribute(key string, value interface{}) {
+	s.r.mu.Lock()
+	defer s.r.mu.Unlock()
+	s.span.Attributes[key] = value
+}
+
+func (s *recordedSpan) RecordError(err error) {
+	s.r.mu.Lock()
+	defer s.r.mu.Unlock()
+	s.span.Errors = append(s.span.Errors, err)
+}
+
+func (s *recordedSpan) End() {
+	s.r.mu.Lock()
+	defer s.r.mu.Unlock()
+	s.span.Ended = true
+}
+
+// traceKey ctx中保存当前span或者从对方收到的追踪信息
+type traceKey struct{}
+
+func (r *Recorder) Start(ctx context.Context, name string, kind SpanKind) (context.Context, Span) {
+	parent, _ := ctx.Value(traceKey{}).(TraceContext)
+	tc := TraceContext{TraceID: parent.TraceID, SpanID: newSpanID(), Flags: parent.Flags}
+	if !parent.IsValid() {
+		tc.TraceID, tc.Flags = newTraceID(), 1
+	}
+	s := &recordedSpan{r: r, span: RecordedSpan{
+		Name:         name,
+		Kind:         kind,
+		TraceContext: tc,
+		Parent:       parent,
+		Attributes:   make(map[string]interface{}),
+	}}
+	r.mu.Lock()
+	r.spans = append(r.spans, s)
+	r.mu.Unlock()
+	return context.WithValue(ctx, traceKey{}, tc), s
+}
+
+func (r *Recorder) Inject(ctx context.Context, md map[string]string) {
+	if tc, ok := ctx.Value(traceKey{}).(TraceContext); ok && tc.IsValid() {
+		md[TraceParentKey] = tc.String()
+	}
+}
+
+func (r *Recorder) Extract(ctx context.Context, md map[string]string) context.Context {
+	tc, err := ParseTraceParent(md[TraceParentKey])
+	if err != nil {
+		return ctx
+	}
+	return context.WithValue(ctx, traceKey{}, tc)
+}
+
+// Spans 返回已经记录的所有span的副本，按照开始的顺序排列
+func (r *Recorder) Spans() []RecordedSpan {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	spans := make([]RecordedSpan, len(r.spans))
+	for i, s := range r.spans {
+		spans[i] = s.span
+		spans[i].Attributes = make(map[string]interface{}, len(s.span.Attributes))
+		for k, v := range s.span.Attributes {
+			spans[i].Attributes[k] = v
+		}
+		spans[i].Errors = append([]error(nil), s.span.Errors...)
+	}
+	return spans
+}
+
+// Reset 清空已经记录的span
+func (r *Recorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.spans = nil
+}
@@ -0,0 +1,192 @@
+package geerpc
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestTracePropagation(t *testing.T) {
+	rec := NewRecorder()
+	addr := startServer(t, NewServer(&ServerOption{Tracer: rec}), new(Calc))
+	client := dialTest(t, addr, &Option{Tracer: rec})
+
+	ctx, parent := rec.Start(context.Background(), "parent", SpanKindClient)
+	var reply int
+	if err := client.CallContext(ctx, "Calc.Sum", CalcArgs{Num1: 1, Num2: 2}, &reply); err != nil {
+		t.Fatal(err)
+	}
+	parent.End()
+	// 服务端先发送响应再结束span
+	spans := waitSpans(t, rec, 3)
+
+	root, cs, ss := spans[0], spans[1], spans[2]
+	if cs.Kind != SpanKindClient || ss.Kind != SpanKindServer {
+		cs, ss = ss, cs
+	}
+	if cs.Name != "Calc.Sum" || ss.Name != "Calc.Sum" {
+		t.Fatalf("unexpected span names %q and %q", cs.Name, ss.Name)
+	}
+	if cs.Parent != root.TraceContext {
+		t.Fatal("client span should be a child of the caller's span")
+	}
+	if ss.Parent != cs.TraceContext {
+		t.Fatal("server span should be a child of the client span")
+	}
+	if ss.TraceContext.TraceID != root.TraceContext.TraceID {
+		t.Fatal("spans should belong to the same trace")
+	}
+	for _, s := range []RecordedSpan{cs, ss} {
+		if s.Attributes[AttrRPCService] != "Calc" || s.Attributes[AttrRPCMethod] != "Sum" ||
+			s.Attributes[AttrCode] != "OK" || s.Attributes[AttrCodec] != "application/gob" {
+			t.Fatalf("unexpected attributes %v", s.Attributes)
+		}
+		if s.Attributes[AttrSeq] != uint64(1) {
+			t.Fatalf("expect seq 1, got %v", s.Attributes[AttrSeq])
+		}
+		if s.Attributes[AttrPeerAddress] == nil {
+			t.Fatal("expect peer address")
+		}
+	}
+}
+
+func TestTraceError(t *testing.T) {
+	rec := NewRecorder()
+	addr := startServer(t, NewServer(&ServerOption{Tracer: rec}), new(Calc))
+	client := dialTest(t, addr, &Option{Tracer: rec})
+
+	var reply int
+	if err := client.Call("Calc.Missing", CalcArgs{}, &reply); err == nil {
+		t.Fatal("expect error")
+	}
+	for _, s := range waitSpans(t, rec, 2) {
+		if len(s.Errors) != 1 || s.Attributes[AttrCode] != "NotFound" {
+			t.Fatalf("expect NotFound error recorded on %s span, got %v %v", s.Kind, s.Errors, s.Attributes)
+		}
+		if s.Parent.IsValid() != (s.Kind == SpanKindServer) {
+			t.Fatalf("unexpected parent of %s span", s.Kind)
+		}
+	}
+}
+
+func TestParseTraceParent(t *testing.T) {
+	const s = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	tc, err := ParseTraceParent(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tc.String() != s || tc.Flags != 1 {
+		t.Fatalf("got %s", tc)
+	}
+	for _, bad := range []string{
+		"",
+		"01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e473x-00f067aa0ba902b7-01",
+	} {
+		if _, err := ParseTraceParent(bad); err == nil {
+			t.Fatalf("expect error for %q", bad)
+		}
+	}
+}
+
+func TestTraceStreamPropagation(t *testing.T) {
+	rec := NewRecorder()
+	addr := startServer(t, NewServer(&ServerOption{Tracer: rec}), new(Calc))
+	client := dialTest(t, addr, &Option{Tracer: rec})
+
+	cs, err := client.NewStream("Calc.Double")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var reply int
+	if err := cs.Send(1); err != nil {
+		t.Fatal(err)
+	}
+	if err := cs.Recv(&reply); err != nil {
+		t.Fatal(err)
+	}
+	_ = cs.CloseSend()
+	if err := cs.Recv(&reply); err != io.EOF {
+		t.Fatal(err)
+	}
+	spans := waitSpans(t, rec, 2)
+	cspan, sspan := spans[0], spans[1]
+	if cspan.Kind != SpanKindClient || sspan.Kind != SpanKindServer {
+		t.Fatalf("unexpected span kinds %s and %s", cspan.Kind, sspan.Kind)
+	}
+	if sspan.Parent != cspan.TraceContext {
+		t.Fatal("server stream span should be a child of the client stream span")
+	}
+	if cspan.Attributes[AttrCode] != "OK" || cspan.Attributes[AttrSeq] != uint64(1) ||
+		cspan.Attributes[AttrPeerAddress] == nil {
+		t.Fatalf("unexpected client stream span attributes %v", cspan.Attributes)
+	}
+}
+
+// waitSpans 等待n个span都结束，按照开始的顺序返回
+func waitSpans(t *testing.T, rec *Recorder, n int) []RecordedSpan {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for {
+		spans := rec.Spans()
+		ended := 0
+		for _, s := range spans {
+			if s.Ended {
+				ended++
+			}
+		}
+		if len(spans) == n && ended == n {
+			return spans
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expect %d ended spans, got %d of %d", n, ended, len(spans))
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestTraceStream(t *testing.T) {
+	rec := NewRecorder()
+	addr := startServer(t, NewServer(&ServerOption{Tracer: rec}), new(Calc))
+	client := dialTest(t, addr)
+
+	cs, err := client.NewStream("Calc.Double")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var reply int
+	if err := cs.Send(1); err != nil {
+		t.Fatal(err)
+	}
+	if err := cs.Recv(&reply); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(rec.Spans()); n != 1 {
+		t.Fatalf("expect the span to start when the stream opens, got %d spans", n)
+	}
+	_ = cs.CloseSend()
+	if err := cs.Recv(&reply); err != io.EOF {
+		t.Fatal(err)
+	}
+	s := waitSpans(t, rec, 1)[0]
+	if s.Name != "Calc.Double" || s.Kind != SpanKindServer || s.Attributes[AttrCode] != "OK" ||
+		s.Attributes[AttrRPCMethod] != "Double" || s.Attributes[AttrSeq] != uint64(1) {
+		t.Fatalf("unexpected stream span %+v", s)
+	}
+
+	rec.Reset()
+	cs, err = client.NewStream("Calc.Missing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cs.Recv(&reply); CodeOf(err) != CodeNotFound {
+		t.Fatalf("err = %v, want CodeNotFound", err)
+	}
+	s = waitSpans(t, rec, 1)[0]
+	if len(s.Errors) != 1 || s.Attributes[AttrCode] != "NotFound" {
+		t.Fatalf("expect NotFound error recorded on the stream span, got %v %v", s.Errors, s.Attributes)
+	}
+}
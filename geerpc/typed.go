@@ -0,0 +1,40 @@
+package geerpc
+
+import "context"
+
+// Invoke 发起一次调用，响应解码到Resp中返回，不需要事先准备响应指针
+// cc可以是*Client、*Pool或*ReconnectClient
+//
+//	sum, err := geerpc.Invoke[CalcArgs, int](ctx, client, "Calc.Sum", CalcArgs{1, 2})
+func Invoke[Req, Resp any](ctx context.Context, cc Invoker, serviceMethod string, req Req) (Resp, error) {
+	var reply Resp
+	if err := cc.CallContext(ctx, serviceMethod, req, &reply); err != nil {
+		var zero Resp
+		return zero, err
+	}
+	return reply, nil
+}
+
+// Method 一个有类型的方法句柄，创建一次之后可以多次调用
+//
+//	sum := geerpc.NewMethod[CalcArgs, int](client, "Calc.Sum")
+//	n, err := sum.Call(ctx, CalcArgs{1, 2})
+type Method[Req, Resp any] struct {
+	cc            Invoker
+	serviceMethod string
+}
+
+// NewMethod 创建cc上serviceMethod的方法句柄
+func NewMethod[Req, Resp any](cc Invoker, serviceMethod string) *Method[Req, Resp] {
+	return &Method[Req, Resp]{cc: cc, serviceMethod: serviceMethod}
+}
+
+// ServiceMethod 返回方法的名字，格式为Service.Method
+func (m *Method[Req, Resp]) ServiceMethod() string {
+	return m.serviceMethod
+}
+
+// Call 发起一次调用
+func (m *Method[Req, Resp]) Call(ctx context.Context, req Req) (Resp, error) {
+	return Invoke[Req, Resp](ctx, m.cc, m.serviceMethod, req)
+}
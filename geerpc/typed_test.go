@@ -0,0 +1,31 @@
+package geerpc
+
+import (
+	"context"
+	"testing"
+)
+
+func TestInvoke(t *testing.T) {
+	client := dialTest(t, startServer(t, NewServer(), new(Calc)))
+	ctx := context.Background()
+
+	sum, err := Invoke[CalcArgs, int](ctx, client, "Calc.Sum", CalcArgs{Num1: 1, Num2: 2})
+	if err != nil || sum != 3 {
+		t.Fatalf("Invoke = %d, %v", sum, err)
+	}
+	// 响应也可以是指针
+	p, err := Invoke[*CalcArgs, *int](ctx, client, "Calc.Sum", &CalcArgs{Num1: 3, Num2: 4})
+	if err != nil || p == nil || *p != 7 {
+		t.Fatalf("Invoke = %v, %v", p, err)
+	}
+	if _, err := Invoke[CalcArgs, int](ctx, client, "Calc.Missing", CalcArgs{}); CodeOf(err) != CodeNotFound {
+		t.Fatalf("Invoke unknown method: err = %v", err)
+	}
+
+	m := NewMethod[CalcArgs, int](client, "Calc.Sum")
+	for i := 0; i < 3; i++ {
+		if sum, err := m.Call(ctx, CalcArgs{Num1: i, Num2: i}); err != nil || sum != 2*i {
+			t.Fatalf("%s = %d, %v", m.ServiceMethod(), sum, err)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package geerpc
+
+import (
+	"geerpc/codec"
+	"runtime"
+	"sync"
+)
+
+const (
+	// writeQueueSize 每个连接上排队等待发送的最大帧数，队列满时发送方阻塞
+	writeQueueSize = 128
+	// maxBatch 一次最多合并发送的帧数
+	maxBatch = 64
+	// yieldProbe 没有并发发送时，每隔这么多批试探一次是否有其他协程在发送
+	yieldProbe = 8
+)
+
+// frame 排队等待发送的一帧报文
+type frame struct {
+	h    codec.Header // 复制一份，发送方可以继续修改自己的header
+	body interface{}
+	n    int           // 编码后的字节数
+	err  error         // 发送的结果
+	done chan struct{} // 发送完毕后写入，frame复用时一起复用
+}
+
+// framePool 每次发送都需要一个frame，复用它们减少GC的压力
+var framePool = sync.Pool{
+	New: func() interface{} {
+		return &frame{done: make(chan struct{}, 1)}
+	},
+}
+
+// connWriter 连接上唯一的写协程
+//
+// 发送方把报文放进队列后等待结果，写协程每次取出队列中已有的所有报文，
+// 依次编码到缓冲区后只flush一次，并发调用很多时可以省掉大部分系统调用。
+// 编解码器没有实现codec.BatchCodec时退化为逐帧发送，此时不统计每一帧的字节数
+type connWriter struct {
+	cc    codec.Codec
+	queue chan *frame
+
+	mu     sync.RWMutex // protect following
+	closed bool
+	stop   chan struct{}
+}
+
+func newConnWriter(cc codec.Codec) *connWriter {
+	w := &connWriter{
+		cc:    cc,
+		queue: make(chan *frame, writeQueueSize),
+		stop:  make(chan struct{}),
+	}
+	go w.loop()
+	return w
+}
+
+// write 发送一帧报文，报文写入连接后才返回，同时返回这一帧的字节数
+func (w *connWriter) write(h *codec.Header, body interface{}) (int, error) {
+	f := framePool.Get().(*frame)
+	f.h, f.body = *h, body
+	w.mu.RLock()
+	if w.closed {
+		w.mu.RUnlock()
+		f.free()
+		return 0, ErrShutdown
+	}
+	// 队列满时在这里阻塞，写协程一直在消费队列，close会等待这里返回
+	w.queue <- f
+	w.mu.RUnlock()
+	<-f.done
+	n, err := f.n, f.err
+	f.free()
+	return n, err
+}
+
+// free 清空frame并放回池中，不再持有header和body引用的对象
+func (f *frame) free() {
+	done := f.done
+	*f = frame{done: done}
+	framePool.Put(f)
+}
+
+// close 停止写协程，之后的write都返回ErrShutdown，已经在队列中的报文仍然会被处理
+// 连接阻塞在发送上时，调用方要先关闭连接
+func (w *connWriter) close() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return
+	}
+	w.closed = true
+	close(w.stop)
+}
+
+func (w *connWriter) loop() {
+	batch := make([]*frame, 0, maxBatch)
+	// 上一批合并了多帧报文，说明有很多协程在并发发送
+	busy := false
+	for round := 0; ; round++ {
+		select {
+		case f := <-w.queue:
+			batch = append(batch[:0], f)
+		case <-w.stop:
+			// close之后不会再有新的报文入队
+			for {
+				select {
+				case f := <-w.queue:
+					w.flush(append(batch[:0], f))
+				default:
+					return
+				}
+			}
+		}
+		// 并发发送时先让出一次CPU，让其他准备发送的协程把报文放进队列，
+		// 串行发送时让出CPU只会增加延迟，只是偶尔试探一下
+		yield := busy || round%yieldProbe == 0
+	collect:
+		for len(batch) < maxBatch {
+			select {
+			case f := <-w.queue:
+				batch = append(batch, f)
+			default:
+				if !yield {
+					break collect
+				}
+				runtime.Gosched()
+				yield = false
+			}
+		}
+		busy = len(batch) > 1
+		w.flush(batch)
+	}
+}
+
+// flush 发送一批报文，并通知每一个发送方
+func (w *connWriter) flush(batch []*frame) {
+	bc, ok := w.cc.(codec.BatchCodec)
+	if !ok {
+		for _, f := range batch {
+			f.err = w.cc.Write(&f.h, f.body)
+			f.done <- struct{}{}
+		}
+		return
+	}
+	for _, f := range batch {
+		f.n, f.err = bc.Encode(&f.h, f.body)
+	}
+	err := bc.Flush()
+	for _, f := range batch {
+		if f.err == nil {
+			f.err = err
+		}
+		f.done <- struct{}{}
+	}
+}
@@ -0,0 +1,149 @@
+package geerpc
+
+import (
+	"geerpc/codec"
+	"sync"
+	"testing"
+	"time"
+)
+
+// batchRecorder 记录每次Flush发送了多少帧，block不为nil时Flush阻塞到它被关闭
+type batchRecorder struct {
+	mu      sync.Mutex
+	encoded int   // 还没有Flush的帧数
+	total   int   // 一共编码的帧数
+	batches []int // 每次Flush发送的帧数
+	block   chan struct{}
+	flushed chan struct{} // 每次进入Flush时写入
+}
+
+func newBatchRecorder() *batchRecorder {
+	return &batchRecorder{block: make(chan struct{}), flushed: make(chan struct{}, writeQueueSize*4)}
+}
+
+func (r *batchRecorder) ReadHeader(*codec.Header) error { return nil }
+func (r *batchRecorder) ReadBody(interface{}) error     { return nil }
+func (r *batchRecorder) Close() error                   { return nil }
+
+func (r *batchRecorder) Write(h *codec.Header, body interface{}) error {
+	if _, err := r.Encode(h, body); err != nil {
+		return err
+	}
+	return r.Flush()
+}
+
+func (r *batchRecorder) Encode(*codec.Header, interface{}) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.encoded++
+	r.total++
+	return 1, nil
+}
+
+func (r *batchRecorder) Flush() error {
+	r.flushed <- struct{}{}
+	<-r.block
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.batches = append(r.batches, r.encoded)
+	r.encoded = 0
+	return nil
+}
+
+func (r *batchRecorder) count() (total int, batches []int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.total, append([]int(nil), r.batches...)
+}
+
+// writeAsync 在n个协程中各发送一帧，返回每次发送的结果
+func writeAsync(w *connWriter, n int) chan error {
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		go func(seq uint64) {
+			_, err := w.write(&codec.Header{Seq: seq}, nil)
+			errs <- err
+		}(uint64(i))
+	}
+	return errs
+}
+
+// waitQueued 等待队列中有n帧报文
+func waitQueued(t *testing.T, w *connWriter, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for len(w.queue) < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("queued %d frames, want %d", len(w.queue), n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestWriterCoalesce(t *testing.T) {
+	r := newBatchRecorder()
+	w := newConnWriter(r)
+	defer w.close()
+
+	// 第一帧发送时阻塞在Flush上，后面的报文都在队列中等待
+	first := writeAsync(w, 1)
+	<-r.flushed
+	const n = 10
+	rest := writeAsync(w, n)
+	waitQueued(t, w, n)
+	close(r.block)
+
+	for i := 0; i < n+1; i++ {
+		var err error
+		select {
+		case err = <-first:
+		case err = <-rest:
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 排队的报文合并成一批，只flush一次
+	if _, batches := r.count(); len(batches) != 2 || batches[0] != 1 || batches[1] != n {
+		t.Fatalf("batches = %v, want [1 %d]", batches, n)
+	}
+}
+
+func TestWriterBackpressure(t *testing.T) {
+	r := newBatchRecorder()
+	w := newConnWriter(r)
+	defer w.close()
+
+	first := writeAsync(w, 1)
+	<-r.flushed
+	// 写协程阻塞时队列最多容纳writeQueueSize帧，多出来的发送方阻塞在入队上
+	const extra = 10
+	rest := writeAsync(w, writeQueueSize+extra)
+	waitQueued(t, w, writeQueueSize)
+	time.Sleep(20 * time.Millisecond)
+	if n := len(w.queue); n != writeQueueSize {
+		t.Fatalf("queued %d frames, want %d", n, writeQueueSize)
+	}
+	if total, _ := r.count(); total != 1 {
+		t.Fatalf("encoded %d frames while flush is blocked, want 1", total)
+	}
+	select {
+	case err := <-rest:
+		t.Fatalf("write returned %v while the writer is blocked", err)
+	default:
+	}
+
+	// 写协程恢复后，阻塞的发送方依次入队，所有报文都被发送
+	close(r.block)
+	if err := <-first; err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < writeQueueSize+extra; i++ {
+		if err := <-rest; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if total, batches := r.count(); total != writeQueueSize+extra+1 {
+		t.Fatalf("encoded %d frames in batches %v, want %d", total, batches, writeQueueSize+extra+1)
+	}
+}
@@ -1,3 +1,7 @@
 module gorpc
 
 go 1.14
+
+require geerpc v0.0.0
+
+replace geerpc => ./geerpc
@@ -1,6 +1,9 @@
 package server
 
-import "gorpc/codec"
+import (
+	"geerpc"
+	"gorpc/codec"
+)
 
 // MagicNumber 客户端传递的MagicNumber必须等于这个常量
 const MagicNumber = 0x3bef5c
@@ -11,6 +14,8 @@ type Option struct {
 	MagicNumber int
 	// 使用的解码器
 	CodecType codec.Type
+	// 客户端的日志，nil表示不输出日志，不会发送给服务端
+	Logger geerpc.Logger `json:"-"`
 }
 
 // DefaultOption 提供一个默认的Option实例，方便使用
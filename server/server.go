@@ -2,9 +2,10 @@ package server
 
 import (
 	"encoding/json"
+	"fmt"
+	"geerpc"
 	"gorpc/codec"
 	"io"
-	"log"
 	"net"
 	"reflect"
 	"sync"
@@ -16,6 +17,9 @@ import (
 // 3、处理请求
 // 4、返回响应内容
 type Server struct {
+	// Logger 输出处理连接时遇到的错误，为nil时不输出
+	// 和geerpc使用同一个日志接口，例如geerpc.NewStdLogger(nil, geerpc.LevelInfo)
+	Logger geerpc.Logger
 }
 
 func NewServer() *Server {
@@ -24,12 +28,19 @@ func NewServer() *Server {
 
 var DefaultServer = NewServer()
 
+// log Logger不为nil时输出一条日志
+func (s *Server) log(level geerpc.LogLevel, msg string, kv ...interface{}) {
+	if s.Logger != nil {
+		s.Logger.Log(level, msg, kv...)
+	}
+}
+
 // StartServer 启动server，监听客户端请求
 func StartServer() {
 	// 随便使用一个端口
 	l, err := net.Listen("tcp", ":0")
 	if err != nil {
-		log.Println("Rpc server listen err: ", err.Error())
+		DefaultServer.log(geerpc.LevelError, "rpc server: listen error", geerpc.LogKeyError, err)
 		return
 	}
 
@@ -37,7 +48,7 @@ func StartServer() {
 		// 等待客户端建立连接
 		conn, err := l.Accept()
 		if err != nil {
-			log.Println("Rpc server accept err: ", err.Error())
+			DefaultServer.log(geerpc.LevelError, "rpc server: accept error", geerpc.LogKeyError, err)
 			continue
 		}
 		go DefaultServer.Accept(conn)
@@ -53,20 +64,20 @@ func (s *Server) Accept(conn net.Conn) {
 	var opt Option
 	err := json.NewDecoder(conn).Decode(&opt)
 	if err != nil {
-		log.Println("Rpc server option decode err: ", err.Error())
+		s.log(geerpc.LevelWarn, "rpc server: option decode error", geerpc.LogKeyRemote, conn.RemoteAddr(), geerpc.LogKeyError, err)
 		return
 	}
 
 	// 对比magic number是否正确
 	if opt.MagicNumber != MagicNumber {
-		log.Println("Rpc server option err, not a valid magic number: ", opt.MagicNumber)
+		s.log(geerpc.LevelWarn, "rpc server: invalid magic number", geerpc.LogKeyRemote, conn.RemoteAddr(), "magic", fmt.Sprintf("%#x", opt.MagicNumber))
 		return
 	}
 
 	// 是否支持该解码器
 	f, ok := codec.NewCodecFuncMap[opt.CodecType]
 	if !ok {
-		log.Println("Rpc server option err, unknown codec type: ", opt.CodecType)
+		s.log(geerpc.LevelWarn, "rpc server: unknown codec type", geerpc.LogKeyRemote, conn.RemoteAddr(), geerpc.LogKeyCodec, opt.CodecType)
 		return
 	}
 	s.handle(f(conn))
@@ -107,7 +118,7 @@ func (s *Server) readRequest(cc codec.Codec) (*request, error) {
 	var h codec.Header
 	if err := cc.ReadHeader(&h); err != nil {
 		if err != io.EOF && err != io.ErrUnexpectedEOF {
-			log.Println("Rpc server handle err, failed to read header: ", err.Error())
+			s.log(geerpc.LevelWarn, "rpc server: read header error", geerpc.LogKeyError, err)
 		}
 		return nil, err
 	}
@@ -120,7 +131,7 @@ func (s *Server) readRequest(cc codec.Codec) (*request, error) {
 	// @todo 现在还不知道body是什么结构
 	req.argv = reflect.New(reflect.TypeOf(""))
 	if err := cc.ReadBody(req.argv.Interface()); err != nil {
-		log.Println("Rpc server handle err, failed to read body: ", err.Error())
+		s.log(geerpc.LevelWarn, "rpc server: read body error", geerpc.LogKeyMethod, h.ServiceMethod, geerpc.LogKeySeq, h.Seq, geerpc.LogKeyError, err)
 		return nil, err
 	}
 	return req, nil
@@ -132,6 +143,6 @@ func (s *Server) sendResponse(cc codec.Codec, req *request, sending *sync.Mutex)
 	// @todo 这里要加锁
 	err := cc.Write(req.header, req.replyv.Interface())
 	if err != nil {
-		log.Println("Rpc server handle err, failed send response: ", err.Error())
+		s.log(geerpc.LevelWarn, "rpc server: write response error", geerpc.LogKeyMethod, req.header.ServiceMethod, geerpc.LogKeySeq, req.header.Seq, geerpc.LogKeyError, err)
 	}
 }